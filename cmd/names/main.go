@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tokenshift/names"
+)
+
+// A flag that can be specified more than once.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// Runs the names command with its arguments (not including the program
+// name), returning the exit status.
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) > 0 {
+		switch args[0] {
+		case "convert":
+			return convert(args[1:], stdout, stderr)
+		case "fmt":
+			return format(args[1:], stdout, stderr)
+		}
+	}
+	return generate(args, stdout, stderr)
+}
+
+// The name files and tables to load names from.
+type nameOptions struct {
+	files stringList
+	dirs stringList
+	tables stringList
+	columns string
+}
+
+// Generates names from templates (or a pattern).
+func generate(args []string, stdout, stderr io.Writer) int {
+	var opts nameOptions
+	flags := flag.NewFlagSet("names", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Var(&opts.files, "f", "name file to load (may be repeated)")
+	flags.Var(&opts.dirs, "d",
+		"directory to search (recursively) for name files (may be repeated)")
+	flags.Var(&opts.tables, "t",
+		"CSV or TSV table of names to load, using -columns (may be repeated)")
+	flags.StringVar(&opts.columns, "columns", "name=name",
+		"column mapping for -t tables, like name=Name,tag=Gender,weight=Count")
+	count := flags.Int("n", 1, "number of names to generate")
+	seed := flags.Int64("seed", 0,
+		"seed for reproducible output (random if not specified)")
+	weighted := flags.Bool("weighted", false,
+		"weight names by how often they appear in the name files")
+
+	flags.Usage = func() {
+		fmt.Fprintln(stderr,
+			"Usage: names [flags] [--] template...")
+		fmt.Fprintln(stderr,
+			"       names [flags] [--] '{template} [{template}] {template}'")
+		fmt.Fprintln(stderr,
+			"       names convert [-to format] [-o output] file")
+		fmt.Fprintln(stderr,
+			"       names fmt [-check] [-sort] file|dir...")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return usageError(err)
+	}
+
+	// Parse name templates on command line. Arguments with slots ("{...}")
+	// are full name patterns, and if there are any, every argument is
+	// combined into a single pattern.
+	templates := make([]names.Matcher, flags.NArg())
+	var pattern names.Pattern
+	for i, arg := range(flags.Args()) {
+		if i > 0 {
+			pattern = append(pattern, names.PatternPart{Text: " "})
+		}
+
+		if strings.Contains(arg, "{") {
+			p, err := names.ParsePattern(arg)
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				return 1
+			}
+			pattern = append(pattern, p...)
+			templates = nil
+			continue
+		}
+
+		template, err := names.ParseTemplate(arg)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		if templates != nil {
+			templates[i] = template
+		}
+		pattern = append(pattern, names.PatternPart{Template: template})
+	}
+
+	// Load name files, defaulting to any in the current directory.
+	nameFiles, err := findNameFiles(opts)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	var generator *names.Generator
+	if isFlagSet(flags, "seed") {
+		generator = names.NewSeededGenerator(*seed)
+	} else {
+		generator = names.NewGenerator()
+	}
+	generator.Weighted = *weighted
+	sources, err := nameSources(nameFiles, opts)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if err := generator.Load(sources...); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	// The templates are only checked and matched once, however many names
+	// are generated.
+	var compiled *names.Compiled
+	if templates != nil {
+		compiled, err = generator.Compile(templates...)
+	} else {
+		compiled, err = generator.CompilePattern(pattern)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	// Pick a random name for each component.
+	for i := 0; i < *count; i++ {
+		fmt.Fprintln(stdout, compiled.Generate())
+	}
+	return 0
+}
+
+// Returns the exit status for a flag parsing error, which the flag set has
+// already reported. Asking for help (-h) isn't an error.
+func usageError(err error) int {
+	if err == flag.ErrHelp {
+		return 0
+	}
+	return 2
+}
+
+// Checks whether a flag was specified on the command line.
+func isFlagSet(flags *flag.FlagSet, name string) bool {
+	set := false
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// Returns the name files specified with -f, plus any found under the
+// directories specified with -d. If none of -f, -d or -t were given, the .names
+// files in the current directory are used.
+func findNameFiles(opts nameOptions) ([]string, error) {
+	if len(opts.files) == 0 && len(opts.dirs) == 0 && len(opts.tables) == 0 {
+		return filepath.Glob("*.names")
+	}
+
+	nameFiles := append([]string(nil), opts.files...)
+	for _, dir := range(opts.dirs) {
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && isNameFile(path) {
+				nameFiles = append(nameFiles, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nameFiles, nil
+}
+
+// Returns the sources to load names from: the name files, plus any tables
+// specified with -t.
+func nameSources(nameFiles []string, opts nameOptions) ([]names.Source, error) {
+	var sources []names.Source
+	for _, filename := range(nameFiles) {
+		sources = append(sources, names.NameFile(filename))
+	}
+
+	if len(opts.tables) > 0 {
+		mapping, err := names.ParseColumnMapping(opts.columns)
+		if err != nil {
+			return nil, err
+		}
+		for _, filename := range(opts.tables) {
+			sources = append(sources, names.NameTable{Filename: filename, Columns: mapping})
+		}
+	}
+
+	return sources, nil
+}
+
+// Checks whether a file found under a -d directory is a name file: either a
+// .names file, or a .names.json or .names.yaml file.
+func isNameFile(path string) bool {
+	lower := strings.ToLower(path)
+	for _, ext := range([]string{".names", ".names.json", ".names.yaml", ".names.yml"}) {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// Converts a name file between the .names, JSON and YAML formats.
+func convert(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("convert", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	to := flags.String("to", "",
+		"format to convert to: names, json or yaml (default from -o)")
+	output := flags.String("o", "", "file to write to (default stdout)")
+	if err := flags.Parse(args); err != nil {
+		return usageError(err)
+	}
+
+	if flags.NArg() != 1 {
+		fmt.Fprintln(stderr,
+			"Usage: names convert [-to format] [-o output] file")
+		flags.PrintDefaults()
+		return 2
+	}
+
+	format := names.Format(*to)
+	if format == "" {
+		if *output == "" {
+			fmt.Fprintln(stderr, "Either -to or -o must be specified.")
+			return 2
+		}
+		format = names.FormatOf(*output)
+	}
+
+	block, err := names.ReadBlock(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	data, err := names.MarshalBlock(block, format)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	if *output == "" {
+		stdout.Write(data)
+	} else if err := ioutil.WriteFile(*output, data, 0644); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// Rewrites .names files (or all of the .names files under directories)
+// canonically. With -check, files are only listed if they need formatting.
+func format(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	check := flags.Bool("check", false,
+		"list files that aren't formatted and exit with an error, instead of rewriting them")
+	sorted := flags.Bool("sort", false, "sort names and blocks")
+	if err := flags.Parse(args); err != nil {
+		return usageError(err)
+	}
+
+	if flags.NArg() == 0 {
+		fmt.Fprintln(stderr, "Usage: names fmt [-check] [-sort] file|dir...")
+		flags.PrintDefaults()
+		return 2
+	}
+
+	failed := false
+	for _, arg := range(flags.Args()) {
+		err := filepath.Walk(arg, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() || (path != arg && filepath.Ext(path) != ".names") {
+				return nil
+			}
+
+			src, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			formatted, err := names.FormatNames(src, *sorted)
+			if errs, ok := err.(names.Errors); ok {
+				for i, e := range(errs) {
+					if e, ok := e.(names.ParseError); ok {
+						e.Filename = path
+						errs[i] = e
+					}
+				}
+			}
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				failed = true
+				return nil
+			}
+
+			if bytes.Equal(src, formatted) {
+				return nil
+			}
+			if *check {
+				fmt.Fprintln(stdout, path)
+				failed = true
+				return nil
+			}
+			return ioutil.WriteFile(path, formatted, info.Mode())
+		})
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			failed = true
+		}
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	. "testing"
+)
+
+// Runs the names command, returning its exit status, standard output and
+// standard error.
+func runNames(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	status := run(args, &stdout, &stderr)
+	return status, stdout.String(), stderr.String()
+}
+
+// Runs the names command, failing the test if it doesn't succeed. Returns the
+// lines of output.
+func mustRunNames(t *T, args ...string) []string {
+	status, stdout, stderr := runNames(args...)
+	if status != 0 {
+		t.Fatalf("names %q exited with %d: %s", args, status, stderr)
+	}
+	return strings.Split(strings.TrimSuffix(stdout, "\n"), "\n")
+}
+
+func assertLines(t *T, expected []string, actual []string) {
+	t.Helper()
+	if strings.Join(expected, "\n") != strings.Join(actual, "\n") {
+		t.Errorf("Expected %q, got %q", expected, actual)
+	}
+}
+
+// Runs the names command, checking that it fails with an error containing a
+// message.
+func assertFails(t *T, status int, message string, args ...string) {
+	t.Helper()
+	actual, _, stderr := runNames(args...)
+	if actual != status {
+		t.Errorf("names %q: expected exit status %d, got %d", args, status, actual)
+	}
+	if !strings.Contains(stderr, message) {
+		t.Errorf("names %q: expected an error containing %q, got %q", args, message, stderr)
+	}
+}
+
+func TestTemplates(t *T) {
+	assertLines(t, []string{"Frannie Goldsmith"},
+		mustRunNames(t, "-f", "testdata/frannie.names", "Boulder:first", "Boulder:last"))
+}
+
+func TestFiles(t *T) {
+	assertLines(t, []string{"Lloyd Goldsmith"},
+		mustRunNames(t, "-f", "testdata/frannie.names", "-f", "testdata/corpus/vegas/vegas.names",
+			"Las Vegas:first", "Boulder:last"))
+
+	// Only the given files are loaded.
+	assertFails(t, 1, "Unknown tag 'Las Vegas'", "-f", "testdata/frannie.names", "Las Vegas")
+	assertFails(t, 1, "no such file", "-f", "testdata/missing.names", ":first")
+}
+
+func TestDirectories(t *T) {
+	assertLines(t, []string{"Stuart Henreid"},
+		mustRunNames(t, "-d", "testdata/corpus", "Boulder:first", "Las Vegas:last"))
+	assertLines(t, []string{"Frannie Henreid"},
+		mustRunNames(t, "-d", "testdata/corpus/vegas", "-f", "testdata/frannie.names",
+			":first - Las Vegas", "Las Vegas:last"))
+}
+
+func TestCurrentDirectory(t *T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir("testdata/corpus"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(dir)
+
+	// Only the .names files directly in the directory are loaded.
+	assertLines(t, []string{"Stuart Redman"}, mustRunNames(t, ":first", ":last"))
+	assertFails(t, 1, "Unknown tag 'Las Vegas'", "Las Vegas")
+}
+
+func TestCount(t *T) {
+	lines := mustRunNames(t, "-n", "5", "-f", "testdata/repeated.names", ":first")
+	if len(lines) != 5 {
+		t.Errorf("Expected 5 names, got %q", lines)
+	}
+	for _, line := range(lines) {
+		if line != "John" && line != "Mary" {
+			t.Errorf("Unexpected name %q", line)
+		}
+	}
+}
+
+func TestSeed(t *T) {
+	args := []string{"-seed", "42", "-n", "20", "-f", "../../Steven King.names", ":first", ":last"}
+	first := mustRunNames(t, args...)
+	assertLines(t, first, mustRunNames(t, args...))
+
+	args[1] = "43"
+	if strings.Join(first, "\n") == strings.Join(mustRunNames(t, args...), "\n") {
+		t.Errorf("Different seeds generated the same names: %q", first)
+	}
+}
+
+func TestWeighted(t *T) {
+	count := func(names []string, name string) int {
+		n := 0
+		for _, s := range(names) {
+			if s == name {
+				n++
+			}
+		}
+		return n
+	}
+
+	// "John" appears nine times as often as "Mary", but is only more likely
+	// with -weighted.
+	args := []string{"-seed", "1", "-n", "500", "-f", "testdata/repeated.names", ":first"}
+	if johns := count(mustRunNames(t, args...), "John"); johns < 200 || johns > 300 {
+		t.Errorf("Expected about 250 Johns without -weighted, got %d", johns)
+	}
+	if johns := count(mustRunNames(t, append([]string{"-weighted"}, args...)...), "John"); johns < 425 {
+		t.Errorf("Expected about 450 Johns with -weighted, got %d", johns)
+	}
+}
+
+func TestTables(t *T) {
+	for _, name := range(mustRunNames(t, "-n", "20", "-t", "../../testdata/census.csv",
+		"-columns", "name=name,tag=gender,attr=year,weight=count,type=first", "F:first + year=1880")) {
+		if name != "Mary" && name != "Anna" && name != "Mary Ann" {
+			t.Errorf("%q is not a female name", name)
+		}
+	}
+	assertFails(t, 1, "", "-t", "../../testdata/census.csv", "-columns", "bogus", ":first")
+}
+
+func TestPatterns(t *T) {
+	assertLines(t, []string{"Dr. Goldsmith, Frannie"},
+		mustRunNames(t, "-f", "testdata/frannie.names", "Dr. {:last},", "{:first}"))
+	assertLines(t, []string{"Frannie Goldsmith"},
+		mustRunNames(t, "-f", "testdata/frannie.names", "{:first}", ":last"))
+	assertLines(t, []string{"Frannie \"Goldsmith\""},
+		mustRunNames(t, "-f", "testdata/frannie.names", `{:first} ["{:last}"]?1`))
+}
+
+func TestInvalidArguments(t *T) {
+	assertFails(t, 1, "col 8: expected tag after '+'", "-f", "testdata/frannie.names", "Male + ")
+	assertFails(t, 1, "'{' is never closed", "-f", "testdata/frannie.names", "{:first")
+	assertFails(t, 2, "flag provided but not defined: -x", "-x", ":first")
+	assertFails(t, 2, "invalid value", "-n", "many", ":first")
+	assertFails(t, 0, "Usage: names", "-h")
+}
+
+func TestConvert(t *T) {
+	status, stdout, stderr := runNames("convert", "-to", "json", "testdata/frannie.names")
+	if status != 0 {
+		t.Fatal(stderr)
+	}
+	if !strings.Contains(stdout, `"Boulder"`) || !strings.Contains(stdout, `"Frannie Goldsmith"`) {
+		t.Errorf("Unexpected JSON: %s", stdout)
+	}
+
+	// The format comes from the output file.
+	output := filepath.Join(t.TempDir(), "frannie.names.yaml")
+	mustRunNames(t, "convert", "-o", output, "testdata/frannie.names")
+	yaml, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// And converting back gives the original file.
+	status, stdout, stderr = runNames("convert", "-to", "names", output)
+	if status != 0 {
+		t.Fatal(stderr)
+	}
+	original, _ := ioutil.ReadFile("testdata/frannie.names")
+	assertLines(t, []string{string(original)}, []string{stdout})
+	if !strings.Contains(string(yaml), "Frannie Goldsmith") {
+		t.Errorf("Unexpected YAML: %s", yaml)
+	}
+
+	assertFails(t, 2, "Either -to or -o must be specified.", "convert", "testdata/frannie.names")
+	assertFails(t, 2, "Usage: names convert", "convert", "-to", "json")
+	assertFails(t, 1, "no such file", "convert", "-to", "json", "testdata/missing.names")
+}
+
+// Copies the unformatted test file to a temporary directory.
+func unformattedFile(t *T) string {
+	src, err := ioutil.ReadFile("testdata/unformatted.names")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "unformatted.names")
+	if err := ioutil.WriteFile(path, src, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFormat(t *T) {
+	path := unformattedFile(t)
+	mustRunNames(t, "fmt", path)
+	formatted, _ := ioutil.ReadFile(path)
+	assertLines(t, []string{"Male {\n\tStuart Redman\n}\n\nTom Cullen\n"}, []string{string(formatted)})
+
+	// Formatted files are left alone, and pass -check.
+	mustRunNames(t, "fmt", "-check", filepath.Dir(path))
+}
+
+func TestFormatSorted(t *T) {
+	path := unformattedFile(t)
+	mustRunNames(t, "fmt", "-sort", path)
+	formatted, _ := ioutil.ReadFile(path)
+	assertLines(t, []string{"Tom Cullen\n\nMale {\n\tStuart Redman\n}\n"}, []string{string(formatted)})
+}
+
+func TestFormatCheck(t *T) {
+	path := unformattedFile(t)
+	status, stdout, _ := runNames("fmt", "-check", filepath.Dir(path))
+	if status != 1 {
+		t.Errorf("Expected exit status 1, got %d", status)
+	}
+	assertLines(t, []string{path}, []string{strings.TrimSuffix(stdout, "\n")})
+
+	// Checking doesn't change the file.
+	original, _ := ioutil.ReadFile("testdata/unformatted.names")
+	unchanged, _ := ioutil.ReadFile(path)
+	assertLines(t, []string{string(original)}, []string{string(unchanged)})
+}
+
+func TestFormatErrors(t *T) {
+	path := filepath.Join(t.TempDir(), "errors.names")
+	if err := ioutil.WriteFile(path, []byte("John Smith\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	assertFails(t, 1, path+":2:1: unexpected '}'", "fmt", path)
+	assertFails(t, 2, "Usage: names fmt", "fmt")
+}
@@ -0,0 +1,321 @@
+// Package names generates random names from lists of tagged names in name
+// files (see the README for the name file and template syntax).
+//
+//	g := names.NewGenerator()
+//	err := g.LoadFiles("Steven King.names")
+//	first, err := names.ParseTemplate("Boulder + Male:first")
+//	last, err := names.ParseTemplate("Boulder:last")
+//	name, err := g.Generate(first, last)
+package names
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Generates random names from a dictionary of names loaded from name files.
+type Generator struct {
+	Dictionary NameDictionary
+
+	// Weight names by how often they appear in the name files, as well as by
+	// their weights. Otherwise, names are picked only by their weights
+	// (which default to 1, giving every matching name an equal probability).
+	Weighted bool
+
+	// The source of randomness for picking names. The same name files,
+	// templates and seed always generate the same names. If it's nil (in a
+	// Generator that wasn't created with NewGenerator), a randomly seeded
+	// source is used.
+	Rand *rand.Rand
+
+	// Tag hierarchies and aliases declared in the name files, which are used
+	// when matching names by their tags.
+	Tags TagHierarchy
+}
+
+// Creates a generator with a randomly seeded source.
+func NewGenerator() *Generator {
+	return NewSeededGenerator(time.Now().UnixNano())
+}
+
+// Creates a generator that will always generate the same sequence of names
+// for the same name files and templates.
+func NewSeededGenerator(seed int64) *Generator {
+	return &Generator{
+		Dictionary: make(NameDictionary),
+		Rand: rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Parses a name template, like "Boulder + Male:first", for a single name
+// component.
+func ParseTemplate(template string) (Matcher, error) {
+	return parseNameTemplate(template)
+}
+
+// Loads names from name files into the generator's dictionary. Every error in
+// every file is returned (as Errors), but names from the parts of the files
+// that could be read are still loaded. Tag declarations that would create a
+// cycle are also returned as errors, and ignored.
+func (g *Generator) LoadFiles(filenames ...string) error {
+	entries, err := parseNameFiles(filenames)
+	return g.add(entries, err)
+}
+
+// Loads names from any sources (like NameFile or NameTable) into the
+// generator's dictionary. Errors are handled the same as LoadFiles.
+func (g *Generator) Load(sources ...Source) error {
+	entries, err := loadSources(sources)
+	return g.add(entries, err)
+}
+
+func (g *Generator) add(entries <-chan Entry, err error) error {
+	if g.Dictionary == nil {
+		g.Dictionary = make(NameDictionary)
+	}
+
+	var errs Errors
+	for entry := range(entries) {
+		if entry.Declaration.Kind != "" {
+			errs = appendErrors(errs, g.Tags.Declare(entry.Declaration))
+		} else {
+			g.Dictionary.AddEntry(entry)
+		}
+	}
+
+	errs = appendErrors(appendErrors(nil, err), errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Returns all of the names in the dictionary that match a template, sorted.
+func (g *Generator) Match(template Matcher) []string {
+	var matches []string
+	for name, props := range(g.Dictionary) {
+		props.Tags = g.Tags.Expand(props.Tags)
+		if matchesName(template, props) {
+			matches = append(matches, name)
+		}
+	}
+
+	// Map iteration order is random, so matches have to be sorted for
+	// generation to be reproducible.
+	sort.Strings(matches)
+	return matches
+}
+
+// Generates a full name, picking a random name for each of the templates.
+// Optional (Maybe) templates are only included with their probability.
+// If any of the templates use an unknown tag or filter, those errors are
+// returned (see Validate). Otherwise, returns a NoMatchError for every
+// template that didn't match any names, even if it was optional, and an
+// AttributeError for every template that compares an attribute that's missing,
+// or isn't a number for a name the rest of the template selects.
+//
+// Each call checks and matches the templates against every loaded name, so
+// use Compile to generate many names from the same templates.
+func (g *Generator) Generate(templates ...Matcher) (string, error) {
+	c, err := g.Compile(templates...)
+	if err != nil {
+		return "", err
+	}
+	return c.Generate(), nil
+}
+
+// Generates a full name from a pattern, filling in each slot with a random
+// name (see Pattern). Optional parts are only included with their
+// probability, and spaces left over from any that aren't are removed. Errors
+// are returned the same as Generate, for every slot (even optional ones).
+func (g *Generator) GeneratePattern(pattern Pattern) (string, error) {
+	c, err := g.CompilePattern(pattern)
+	if err != nil {
+		return "", err
+	}
+	return c.Generate(), nil
+}
+
+// Templates (or a pattern) that have been checked and matched against a
+// generator's names, for generating any number of names from them. Names
+// loaded into the generator after compiling aren't used.
+type Compiled struct {
+	g *Generator
+	templates []Matcher
+	pattern Pattern
+
+	// The names matching each template (or each slot of the pattern, in the
+	// order of Pattern.Templates).
+	matches [][]string
+}
+
+// Checks and matches templates for Generate, returning the same errors.
+func (g *Generator) Compile(templates ...Matcher) (*Compiled, error) {
+	matches, err := g.compile(templates)
+	if err != nil {
+		return nil, err
+	}
+	return &Compiled{g: g, templates: templates, matches: matches}, nil
+}
+
+// Checks and matches the slots of a pattern for GeneratePattern, returning
+// the same errors.
+func (g *Generator) CompilePattern(pattern Pattern) (*Compiled, error) {
+	matches, err := g.compile(pattern.Templates())
+	if err != nil {
+		return nil, err
+	}
+	return &Compiled{g: g, pattern: pattern, matches: matches}, nil
+}
+
+func (g *Generator) compile(templates []Matcher) ([][]string, error) {
+	if err := g.Validate(templates...); err != nil {
+		return nil, err
+	}
+
+	attributeErrs := make([]error, len(templates))
+	for i, template := range(templates) {
+		attributeErrs[i] = checkNumericAttributes(template, g.Dictionary, &g.Tags)
+	}
+
+	// Each name's tags are only expanded once, for all of the templates.
+	matches := make([][]string, len(templates))
+	for name, props := range(g.Dictionary) {
+		props.Tags = g.Tags.Expand(props.Tags)
+		for i, template := range(templates) {
+			if matchesName(template, props) {
+				matches[i] = append(matches[i], name)
+			}
+		}
+	}
+
+	var errs Errors
+	for i, template := range(templates) {
+		if attributeErrs[i] != nil {
+			errs = append(errs, attributeErrs[i])
+		} else if len(matches[i]) == 0 {
+			errs = append(errs, NoMatchError{template})
+		}
+
+		// Map iteration order is random, so matches have to be sorted for
+		// generation to be reproducible.
+		sort.Strings(matches[i])
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return matches, nil
+}
+
+// Generates a full name from the compiled templates or pattern.
+func (c *Compiled) Generate() string {
+	if c.pattern != nil {
+		var buf bytes.Buffer
+		c.writePattern(&buf, c.pattern, c.matches)
+
+		// Only ASCII spaces are collapsed, since names can contain other
+		// spaces (like ideographic spaces).
+		words := strings.FieldsFunc(buf.String(), func(r rune) bool {
+			return r == ' '
+		})
+		return strings.Join(words, " ")
+	}
+
+	var components []string
+	for i, template := range(c.templates) {
+		if maybe, ok := template.(Maybe); ok {
+			if c.g.random().Float64() >= maybe.Probability {
+				continue
+			}
+		}
+		components = append(components, c.g.pick(c.matches[i]))
+	}
+	return strings.Join(components, " ")
+}
+
+// Writes a pattern, using the matches for its slots (and those of its
+// optional parts), and returns the matches for the slots after it.
+func (c *Compiled) writePattern(buf *bytes.Buffer, pattern Pattern, matches [][]string) [][]string {
+	for _, part := range(pattern) {
+		switch {
+		case part.Template != nil:
+			names := matches[0]
+			matches = matches[1:]
+			if maybe, ok := part.Template.(Maybe); ok {
+				if c.g.random().Float64() >= maybe.Probability {
+					continue
+				}
+			}
+			buf.WriteString(c.g.pick(names))
+		case part.Optional != nil:
+			if c.g.random().Float64() < part.Probability {
+				matches = c.writePattern(buf, part.Optional, matches)
+			} else {
+				matches = matches[len(part.Optional.Templates()):]
+			}
+		default:
+			buf.WriteString(part.Text)
+		}
+	}
+	return matches
+}
+
+// Returns the weight of a name when picking between matches. Names that are
+// only in name tables are weighted by how often they occur (the total of their
+// rows' weights), with or without Weighted.
+func (g *Generator) Weight(name string) float64 {
+	props := g.Dictionary[name]
+	if props.Count == 0 && props.Frequency > 0 {
+		return props.Frequency
+	}
+
+	weight := props.Weight
+	if weight <= 0 {
+		weight = 1
+	}
+	if g.Weighted {
+		return weight * float64(props.Count)
+	}
+	return weight
+}
+
+// Returns the generator's source of randomness, creating one if it doesn't
+// have one yet.
+func (g *Generator) random() *rand.Rand {
+	if g.Rand == nil {
+		g.Rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return g.Rand
+}
+
+// Picks a random name, according to the names' weights.
+func (g *Generator) pick(names []string) string {
+	total := 0.0
+	for _, name := range(names) {
+		total += g.Weight(name)
+	}
+
+	r := g.random().Float64() * total
+	for _, name := range(names) {
+		r -= g.Weight(name)
+		if r < 0 {
+			return name
+		}
+	}
+
+	// Only reachable through floating point rounding.
+	return names[len(names)-1]
+}
+
+// Returned when a template doesn't match any of the loaded names.
+type NoMatchError struct {
+	Template Matcher
+}
+
+func (e NoMatchError) Error() string {
+	return fmt.Sprintf("No match for %v", e.Template)
+}
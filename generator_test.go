@@ -0,0 +1,335 @@
+package names
+
+import (
+	"math/rand"
+	"strings"
+	. "testing"
+)
+
+func testGenerator(t *T) *Generator {
+	g := NewGenerator()
+	if err := g.LoadFiles("Steven King.names"); err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func mustParseTemplate(t *T, template string) Matcher {
+	m, err := ParseTemplate(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestGenerate(t *T) {
+	g := testGenerator(t)
+	first := mustParseTemplate(t, "Boulder + Female:first")
+	last := mustParseTemplate(t, "Las Vegas:last")
+
+	for i := 0; i < 20; i++ {
+		name, err := g.Generate(first, last)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		parts := strings.Split(name, " ")
+		if len(parts) != 2 {
+			t.Fatalf("Expected a first and last name, got %q", name)
+		}
+		if props := g.Dictionary[parts[0]]; !props.First || !props.HasTag("Female") {
+			t.Errorf("%q is not a female first name", parts[0])
+		}
+		if props := g.Dictionary[parts[1]]; !props.Last || !props.HasTag("Las Vegas") {
+			t.Errorf("%q is not a Las Vegas last name", parts[1])
+		}
+	}
+}
+
+func TestGenerateNoMatch(t *T) {
+	g := testGenerator(t)
+	first := mustParseTemplate(t, "Boulder:first")
+	missing := mustParseTemplate(t, "Dog:given")
+	dog := mustParseTemplate(t, "Dog:last - Dog")
+
+	_, err := g.Generate(first, missing, dog)
+	assertEquals(t, Errors{NoMatchError{missing}, NoMatchError{dog}}, err)
+}
+
+func TestMatchWeighted(t *T) {
+	g := testGenerator(t)
+	template := mustParseTemplate(t, "Boulder:last + Female")
+
+	assertEquals(t,
+		[]string{"Abagail", "Cross", "Goldsmith", "Jurgens", "Stern", "Swann"},
+		g.Match(template))
+	assertEquals(t, 1.0, g.Weight("Goldsmith"))
+	assertEquals(t, 1.0, g.Weight("Cross"))
+
+	// "Goldsmith" and "Stern" each appear in two names, and "Abagail" is
+	// both a first and last name.
+	g.Weighted = true
+	assertEquals(t, 2.0, g.Weight("Goldsmith"))
+	assertEquals(t, 2.0, g.Weight("Stern"))
+	assertEquals(t, 2.0, g.Weight("Abagail"))
+	assertEquals(t, 1.0, g.Weight("Cross"))
+}
+
+func TestGenerateWeighted(t *T) {
+	g := NewSeededGenerator(1)
+	if err := g.LoadFiles("testdata/weights.names"); err != nil {
+		t.Fatal(err)
+	}
+
+	assertEquals(t, 50.0, g.Weight("John"))
+	assertEquals(t, 20.0, g.Weight("Jane"))
+	assertEquals(t, 10.0, g.Weight("Mary"))
+	assertEquals(t, 5.0, g.Weight("Abagail"))
+	assertEquals(t, 0.5, g.Weight("Ebenezer"))
+
+	template := mustParseTemplate(t, ":first")
+	counts := make(map[string]int)
+	for i := 0; i < 2000; i++ {
+		name, err := g.Generate(template)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[name]++
+	}
+
+	// Out of a total weight of 85.5, John should be picked ~58% of the
+	// time, Jane ~23%, Mary ~12%, Abagail ~6% and Ebenezer ~0.6%.
+	assertEquals(t, map[string]int{
+		"John": 1159,
+		"Jane": 495,
+		"Mary": 225,
+		"Abagail": 113,
+		"Ebenezer": 8,
+	}, counts)
+}
+
+func TestGenerateUnweightedEntries(t *T) {
+	// Entries from other sources might not have weights, which count as 1.
+	g := NewSeededGenerator(1)
+	for _, name := range([]string{"Alice", "Bob", "Carol"}) {
+		g.Dictionary.AddEntry(Entry{Name: name, Type: "first"})
+	}
+	g.Dictionary.Add("Dave", Properties{First: true, NotNick: true, Count: 1})
+	assertEquals(t, 1.0, g.Weight("Alice"))
+	assertEquals(t, 1.0, g.Weight("Dave"))
+
+	first := mustParseTemplate(t, ":first")
+	counts := make(map[string]int)
+	for i := 0; i < 4000; i++ {
+		name, err := g.Generate(first)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[name]++
+	}
+	for _, name := range([]string{"Alice", "Bob", "Carol", "Dave"}) {
+		if counts[name] < 900 || counts[name] > 1100 {
+			t.Errorf("Expected %s about 1000 times, got %d", name, counts[name])
+		}
+	}
+}
+
+func TestLoadMissingFile(t *T) {
+	g := NewGenerator()
+	if err := g.LoadFiles("testdata/missing.names"); err == nil {
+		t.Error("Loading a missing file should have failed.")
+	}
+}
+
+func TestGenerateSeeded(t *T) {
+	first := mustParseTemplate(t, "Male:first")
+	last := mustParseTemplate(t, ":last")
+
+	generate := func() []string {
+		g := NewSeededGenerator(42)
+		if err := g.LoadFiles("Steven King.names"); err != nil {
+			t.Fatal(err)
+		}
+
+		var generated []string
+		for i := 0; i < 5; i++ {
+			name, err := g.Generate(first, last)
+			if err != nil {
+				t.Fatal(err)
+			}
+			generated = append(generated, name)
+		}
+		return generated
+	}
+
+	// The same seed generates the same names, every time.
+	expected := []string{
+		"Larry Andros",
+		"Peter Creighton",
+		"Barry Engstrom",
+		"Susan Engstrom",
+		"Larry Kojak",
+	}
+	assertEquals(t, expected, generate())
+	assertEquals(t, expected, generate())
+}
+
+func TestCompile(t *T) {
+	g := NewSeededGenerator(42)
+	if err := g.LoadFiles("Steven King.names"); err != nil {
+		t.Fatal(err)
+	}
+	templates := []Matcher{mustParseTemplate(t, "[Male:first]"), mustParseTemplate(t, ":last")}
+
+	expected := make([]string, 10)
+	for i := range(expected) {
+		expected[i], _ = g.Generate(templates...)
+	}
+
+	// Compiled templates generate the same names as Generate.
+	g.Rand.Seed(42)
+	c, err := g.Compile(templates...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range(expected) {
+		assertEquals(t, name, c.Generate())
+	}
+
+	// But not names loaded after they were compiled.
+	g.Dictionary.AddEntry(Entry{Name: "Zed", Type: "last", Weight: 1e9})
+	for i := 0; i < 10; i++ {
+		if name := c.Generate(); strings.HasSuffix(name, "Zed") {
+			t.Errorf("Generated %q from a name loaded after compiling", name)
+		}
+	}
+
+	_, err = g.Compile(mustParseTemplate(t, "Dog:given"))
+	assertEquals(t, Errors{NoMatchError{mustParseTemplate(t, "Dog:given")}}, err)
+}
+
+func TestZeroValueGenerator(t *T) {
+	var g Generator
+	if err := g.LoadFiles("Steven King.names"); err != nil {
+		t.Fatal(err)
+	}
+
+	name, err := g.Generate(mustParseTemplate(t, "[Male:first]"), mustParseTemplate(t, "Boulder:last"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name == "" {
+		t.Error("Expected a name")
+	}
+	if g.Rand == nil {
+		t.Error("Expected the generator to have a source of randomness")
+	}
+}
+
+func TestGenerateMaybe(t *T) {
+	g := testGenerator(t)
+	g.Rand = rand.New(rand.NewSource(1))
+	first := mustParseTemplate(t, ":first")
+	last := mustParseTemplate(t, ":last")
+
+	// Counts how many of 2000 generated names include the middle name. With
+	// a fixed seed the counts are exact, but they should also be close to
+	// the expected proportion.
+	countMiddle := func(middle Matcher) int {
+		count := 0
+		for i := 0; i < 2000; i++ {
+			name, err := g.Generate(first, middle, last)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(strings.Split(name, " ")) == 3 {
+				count++
+			}
+		}
+		return count
+	}
+
+	assertEquals(t, 1038, countMiddle(mustParseTemplate(t, "[:given]")))
+	assertEquals(t, 629, countMiddle(mustParseTemplate(t, "[:given]?0.3")))
+	assertEquals(t, 0, countMiddle(mustParseTemplate(t, "[:given]?0")))
+	assertEquals(t, 2000, countMiddle(mustParseTemplate(t, "[:given]?1")))
+}
+
+func TestMatchTagHierarchy(t *T) {
+	g := NewGenerator()
+	if err := g.LoadFiles("testdata/hierarchy.names"); err != nil {
+		t.Fatal(err)
+	}
+
+	assertEquals(t, []string{"Lloyd", "Nadine", "Tom"},
+		g.Match(mustParseTemplate(t, "Nevada:first")))
+	assertEquals(t, []string{"Lloyd", "Stuart", "Tom"},
+		g.Match(mustParseTemplate(t, "USA + Male:first")))
+	assertEquals(t, []string{"Lloyd", "Stuart", "Tom"},
+		g.Match(mustParseTemplate(t, "m:first")))
+	assertEquals(t, []string{"Nadine"},
+		g.Match(mustParseTemplate(t, "USA:first - Man")))
+}
+
+func TestLoadTagCycle(t *T) {
+	g := NewGenerator()
+	err := g.LoadFiles("testdata/hierarchy.names", "testdata/cycle.names")
+
+	errs, ok := err.(Errors)
+	if !ok || len(errs) != 1 {
+		t.Fatalf("Expected 1 error, got %v", err)
+	}
+	assertEquals(t, "Invalid tag declaration 'tag Boulder > USA': "+
+		"tag cycle: USA > Colorado > Boulder > USA", errs[0].Error())
+
+	// The rest of the names and declarations are still loaded.
+	assertEquals(t, []string{"Richard", "Stuart"},
+		g.Match(mustParseTemplate(t, "Colorado:first")))
+}
+
+func TestMatchNumericAttributes(t *T) {
+	g := NewGenerator()
+	if err := g.LoadFiles("testdata/years.names"); err != nil {
+		t.Fatal(err)
+	}
+
+	assertEquals(t, []string{"Deborah", "Jennifer", "Linda"},
+		g.Match(mustParseTemplate(t, "year>=1950")))
+	assertEquals(t, []string{"Deborah", "Linda"},
+		g.Match(mustParseTemplate(t, "year in 1950..1960")))
+	assertEquals(t, []string{"Dorothy", "Linda"},
+		g.Match(mustParseTemplate(t, "rank<10")))
+}
+
+func TestGenerateNumericAttributeErrors(t *T) {
+	g := NewGenerator()
+	if err := g.LoadFiles("testdata/years.names", "Steven King.names"); err != nil {
+		t.Fatal(err)
+	}
+	g.Dictionary.AddEntry(Entry{
+		Name: "Susan",
+		Type: "first",
+		Attributes: map[string]string{"rank": "unranked"},
+		Weight: 1,
+	})
+
+	_, err := g.Generate(
+		mustParseTemplate(t, "year>=1950"),
+		mustParseTemplate(t, "[popularity<5]"),
+		mustParseTemplate(t, "Boulder - rank in 1..10"))
+	assertEquals(t, Errors{
+		AttributeError{Key: "popularity"},
+		AttributeError{Key: "rank", Name: "Susan", Value: "unranked"},
+	}, err)
+	assertEquals(t, "No names have a value for 'popularity'\n"+
+		"The value of 'rank' for Susan is not a number: 'unranked'", err.Error())
+
+	// Values that aren't numbers only matter for names the rest of the
+	// template selects.
+	_, err = g.Generate(
+		mustParseTemplate(t, "year>=1950"),
+		mustParseTemplate(t, "Las Vegas - rank in 1..10"))
+	if err != nil {
+		t.Error(err)
+	}
+}
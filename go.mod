@@ -0,0 +1,8 @@
+module github.com/tokenshift/names
+
+go 1.16
+
+require (
+	github.com/prataprc/goparsec v0.0.0-20211219142520-daac0e635e7e
+	gopkg.in/yaml.v2 v2.4.0
+)
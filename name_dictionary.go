@@ -1,4 +1,9 @@
-package main
+package names
+
+import (
+	"strconv"
+	"strings"
+)
 
 // Contains a set of names associated with tags.
 type NameDictionary map[string]Properties
@@ -11,12 +16,41 @@ func (d NameDictionary) Add(name string, p Properties) NameDictionary {
 		entry.Given = entry.Given || p.Given
 		entry.Last = entry.Last || p.Last
 		entry.Nick = entry.Nick || p.Nick
+		entry.Initial = entry.Initial || p.Initial
 
 		// Nicknames are treated specially, and will never be returned in a
 		// generated name unless :nick is explicitly specified. Because of this
 		// we need to track if the name was EVER input as a normal (rather than
 		// nick) name, and if so, allow it to be used as such OR as a nickname.
-		entry.NotNick = entry.NotNick || !entry.Nick
+		entry.NotNick = entry.NotNick || !p.Nick
+
+		// A name is tagged with every tag it was given anywhere in the input.
+		for _, tag := range(p.Tags) {
+			if !entry.HasTag(tag) {
+				entry.Tags = append(entry.Tags, tag)
+			}
+		}
+
+		// Likewise, a name has every value it was given for an attribute.
+		for key, values := range(p.Attributes) {
+			for _, value := range(values) {
+				if !entry.HasAttribute(key, value) {
+					if entry.Attributes == nil {
+						entry.Attributes = make(map[string][]string)
+					}
+					entry.Attributes[key] = append(entry.Attributes[key], value)
+				}
+			}
+		}
+
+		entry.Count += p.Count
+		entry.Frequency += p.Frequency
+
+		// Names that appear in more than one place use their highest weight,
+		// so that repeating a name doesn't change how likely it is.
+		if p.Weight > entry.Weight {
+			entry.Weight = p.Weight
+		}
 
 		d[name] = entry
 	} else {
@@ -26,8 +60,98 @@ func (d NameDictionary) Add(name string, p Properties) NameDictionary {
 	return d
 }
 
+// Adds a single name component parsed from a name file or table. Tag
+// declarations are ignored (see TagHierarchy), and entries without a weight
+// get a weight of 1.
+func (d NameDictionary) AddEntry(e Entry) NameDictionary {
+	if e.Declaration.Kind != "" {
+		return d
+	}
+	if e.Weight <= 0 {
+		e.Weight = 1
+	}
+
+	p := Properties{
+		First: e.Type == "first",
+		Given: e.Type == "given",
+		Last: e.Type == "last",
+		Nick: e.Type == "nick",
+		Initial: e.Type == "initial",
+		NotNick: e.Type != "nick",
+		Tags: make([]Tag, len(e.Tags)),
+		Count: 1,
+		Weight: e.Weight,
+	}
+	if e.Frequency {
+		p.Count = 0
+		p.Weight = 0
+		p.Frequency = e.Weight
+	}
+	for i, tag := range(e.Tags) {
+		p.Tags[i] = Tag(tag)
+	}
+	for key, value := range(e.Attributes) {
+		if p.Attributes == nil {
+			p.Attributes = make(map[string][]string)
+		}
+		key = strings.ToLower(key)
+		p.Attributes[key] = append(p.Attributes[key], value)
+	}
+
+	return d.Add(e.Name, p)
+}
+
 // The properties for a single name in the dictionary.
 type Properties struct {
-	First, Given, Last, Nick, NotNick bool
+	First, Given, Last, Nick, NotNick, Initial bool
 	Tags []Tag
+
+	// Every value of each key/value tag the name was given. Keys are lower
+	// case.
+	Attributes map[string][]string
+
+	// The number of name components this name was parsed from, used to
+	// weight names by how often they appear in the name files.
+	Count int
+
+	// How likely the name is to be picked, relative to other names. Names
+	// without a weight (0) count as 1.
+	Weight float64
+
+	// How often the name occurs in name tables: the sum of the weights of
+	// every row it's in.
+	Frequency float64
+}
+
+// Checks whether a name has a tag. Tags are case insensitive ("éire" matches
+// "Éire").
+func (p Properties) HasTag(tag Tag) bool {
+	for _, t := range(p.Tags) {
+		if strings.EqualFold(string(t), string(tag)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks whether a name has a value for an attribute. Like tags, keys and
+// values are case insensitive.
+func (p Properties) HasAttribute(key, value string) bool {
+	for _, v := range(p.Attributes[strings.ToLower(key)]) {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the values of an attribute that are numbers.
+func (p Properties) NumericAttribute(key string) []float64 {
+	var numbers []float64
+	for _, v := range(p.Attributes[strings.ToLower(key)]) {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			numbers = append(numbers, f)
+		}
+	}
+	return numbers
 }
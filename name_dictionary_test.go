@@ -0,0 +1,78 @@
+package names
+
+import (
+	. "testing"
+)
+
+func TestAddMergesRepeatedNames(t *T) {
+	dict := make(NameDictionary)
+	dict.AddEntry(Entry{Name: "Susan", Type: "first", Tags: []string{"Boulder", "Female"}})
+	dict.AddEntry(Entry{Name: "Susan", Type: "first", Tags: []string{"Boulder", "Male"}})
+	dict.AddEntry(Entry{Name: "Susan", Type: "given", Tags: []string{"Boulder"}})
+
+	assertEquals(t, 1, len(dict))
+	assertEquals(t, Properties{
+		First: true,
+		Given: true,
+		NotNick: true,
+		Tags: []Tag{"Boulder", "Female", "Male"},
+		Count: 3,
+		Weight: 1,
+	}, dict["Susan"])
+}
+
+func TestAddKeepsNamesSeparate(t *T) {
+	dict := make(NameDictionary)
+	dict.AddEntry(Entry{Name: "Peter", Type: "first"})
+	dict.AddEntry(Entry{Name: "Redman", Type: "last"})
+
+	assertEquals(t, 2, len(dict))
+	assertEquals(t, true, dict["Peter"].First)
+	assertEquals(t, false, dict["Peter"].Last)
+	assertEquals(t, true, dict["Redman"].Last)
+	assertEquals(t, false, dict["Redman"].First)
+}
+
+func TestDictionaryFromNameFile(t *T) {
+	dict := make(NameDictionary)
+	entries, err := parseNameFile("Steven King.names")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for entry := range(entries) {
+		dict.AddEntry(entry)
+	}
+
+	// "Susan Stern" appears in two blocks, but is only one name (counted as
+	// both a first and a given name each time).
+	assertEquals(t, 4, dict["Susan"].Count)
+	assertEquals(t, []Tag{"Steven King", "Fiction", "Character", "Boulder", "Female", "Male"}, dict["Susan"].Tags)
+
+	// "Goldsmith" is a last name in two different full names.
+	assertEquals(t, true, dict["Goldsmith"].Last)
+	assertEquals(t, 2, dict["Goldsmith"].Count)
+}
+
+func TestNicknameAlsoUsedAsName(t *T) {
+	dict := make(NameDictionary)
+	dict.AddEntry(Entry{Name: "Jimmy", Type: "nick"})
+	assertEquals(t, false, dict["Jimmy"].NotNick)
+
+	dict.AddEntry(Entry{Name: "Jimmy", Type: "first"})
+	assertEquals(t, true, dict["Jimmy"].NotNick)
+	assertEquals(t, true, dict["Jimmy"].Nick)
+
+	// Once a name has been used normally, it stays usable.
+	dict.AddEntry(Entry{Name: "Jimmy", Type: "nick"})
+	assertEquals(t, true, dict["Jimmy"].NotNick)
+}
+
+func TestAddUsesHighestWeight(t *T) {
+	dict := make(NameDictionary)
+	dict.AddEntry(Entry{Name: "John", Type: "first", Weight: 5})
+	dict.AddEntry(Entry{Name: "John", Type: "first", Weight: 50})
+	dict.AddEntry(Entry{Name: "John", Type: "given", Weight: 1})
+
+	assertEquals(t, 50.0, dict["John"].Weight)
+	assertEquals(t, 3, dict["John"].Count)
+}
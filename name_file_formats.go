@@ -0,0 +1,342 @@
+package names
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	p "github.com/prataprc/goparsec"
+	"gopkg.in/yaml.v2"
+)
+
+// A name file format.
+type Format string
+
+const (
+	NamesFormat Format = "names"
+	JSONFormat Format = "json"
+	YAMLFormat Format = "yaml"
+)
+
+// Returns the format of a name file, based on its extension. Anything other
+// than ".json", ".yaml" or ".yml" is treated as a .names file.
+func FormatOf(filename string) Format {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		return JSONFormat
+	case ".yaml", ".yml":
+		return YAMLFormat
+	}
+	return NamesFormat
+}
+
+// The JSON and YAML representation of a block. Names are either strings, or
+// objects with their own tags, weight and/or comments:
+//
+//	{
+//	  "comments": ["// The Boulder Free Zone."],
+//	  "tags": ["Boulder", "Male"],
+//	  "weight": 10,
+//	  "names": ["Stuart Redman", {"name": "Kojak", "tags": ["Dog"]}],
+//	  "blocks": [...],
+//	  "end_comments": [...]
+//	}
+//
+// A "comment" is a comment at the end of the line a name (or a block's
+// closing brace) is on. Include statements are blocks with just an "include"
+// path, and tag declarations are blocks with just a "declare" object like
+// {"kind": "tag", "tag": "Nevada", "tags": ["Las Vegas"]} (either can also
+// have comments).
+type fileBlock struct {
+	Comments []string `json:"comments,omitempty" yaml:"comments,omitempty"`
+	Comment string `json:"comment,omitempty" yaml:"comment,omitempty"`
+	Include string `json:"include,omitempty" yaml:"include,omitempty"`
+	Declaration *TagDeclaration `json:"declare,omitempty" yaml:"declare,omitempty"`
+	Tags []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Weight float64 `json:"weight,omitempty" yaml:"weight,omitempty"`
+	Names []interface{} `json:"names,omitempty" yaml:"names,omitempty"`
+	Blocks []fileBlock `json:"blocks,omitempty" yaml:"blocks,omitempty"`
+	EndComments []string `json:"end_comments,omitempty" yaml:"end_comments,omitempty"`
+}
+
+// A name with inline tags, a weight and/or comments.
+type fileName struct {
+	Comments []string `json:"comments,omitempty" yaml:"comments,omitempty"`
+	Comment string `json:"comment,omitempty" yaml:"comment,omitempty"`
+	Name string `json:"name" yaml:"name"`
+	Tags []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Weight float64 `json:"weight,omitempty" yaml:"weight,omitempty"`
+}
+
+// Writes a block in the specified format.
+func MarshalBlock(b Block, format Format) ([]byte, error) {
+	switch format {
+	case JSONFormat:
+		data, err := json.MarshalIndent(encodeBlock(b), "", "  ")
+		return append(data, '\n'), err
+	case YAMLFormat:
+		return yaml.Marshal(encodeBlock(b))
+	case NamesFormat:
+		if errs := checkNamesSyntax(b); len(errs) > 0 {
+			return nil, errs
+		}
+		return []byte(formatBlock(b)), nil
+	}
+	return nil, fmt.Errorf("Unknown name file format: '%s'", format)
+}
+
+// Checks that a block can be written as a .names file. Blocks read from JSON
+// or YAML can have names, tags and comments that can't be parsed from a
+// .names file (like a tag with a ":" in it).
+func checkNamesSyntax(b Block) Errors {
+	var errs Errors
+	invalid := func(what, value string) {
+		errs = append(errs, fmt.Errorf("Not a valid %s for a .names file: %q", what, value))
+	}
+
+	for _, n := range(b.Names) {
+		if !matchesAll(name, n) {
+			invalid("name", n)
+		}
+	}
+	for _, c := range(b.Comments) {
+		if !matchesAll(comment, c) {
+			invalid("comment", c)
+		}
+	}
+
+	for _, child := range(b.Children) {
+		for _, c := range(child.Doc) {
+			if !matchesAll(comment, c) {
+				invalid("comment", c)
+			}
+		}
+		if child.Comment != "" && !matchesAll(comment, child.Comment) {
+			invalid("comment", child.Comment)
+		}
+
+		switch {
+		case child.Include != "":
+			if strings.ContainsAny(child.Include, "\"\n") {
+				invalid("include path", child.Include)
+			}
+		case child.Declaration.Kind != "":
+			for _, t := range(append([]string{child.Declaration.Tag}, child.Declaration.Tags...)) {
+				if !matchesAll(tag, t) {
+					invalid("tag", t)
+				}
+			}
+		default:
+			for _, t := range(child.Tags) {
+				if !matchesAll(parseTagOrAttribute, t) {
+					invalid("tag", t)
+				}
+			}
+			errs = append(errs, checkNamesSyntax(child.Block)...)
+		}
+	}
+	return errs
+}
+
+// Checks whether a parser matches the whole of a string.
+func matchesAll(parser p.Parser, s string) bool {
+	n, scanner := parser(p.NewScanner([]byte(s)))
+	if n == nil {
+		return false
+	}
+	_, scanner = scanner.SkipWS()
+	return scanner.Endof()
+}
+
+func parseJSON(buffer []byte) (Block, error) {
+	var fb fileBlock
+	if err := json.Unmarshal(buffer, &fb); err != nil {
+		return Block{}, err
+	}
+	return decodeBlock(fb)
+}
+
+func parseYAML(buffer []byte) (Block, error) {
+	var fb fileBlock
+	if err := yaml.Unmarshal(buffer, &fb); err != nil {
+		return Block{}, err
+	}
+	return decodeBlock(fb)
+}
+
+func encodeBlock(b Block) fileBlock {
+	fb := fileBlock{EndComments: b.Comments}
+	for _, name := range(b.Names) {
+		fb.Names = append(fb.Names, name)
+	}
+
+	for _, child := range(b.Children) {
+		if isPlainName(child) {
+			fb.Names = append(fb.Names, child.Names[0])
+		} else if child.Inline {
+			fb.Names = append(fb.Names, fileName{
+				Comments: child.Doc,
+				Comment: child.Comment,
+				Name: child.Names[0],
+				Tags: child.Tags,
+				Weight: child.Weight,
+			})
+		} else {
+			fb.Blocks = append(fb.Blocks, encodeTaggedBlock(child))
+		}
+	}
+
+	return fb
+}
+
+func encodeTaggedBlock(tb TaggedBlock) fileBlock {
+	if tb.Include != "" {
+		return fileBlock{Comments: tb.Doc, Comment: tb.Comment, Include: tb.Include}
+	}
+	if tb.Declaration.Kind != "" {
+		declaration := tb.Declaration
+		return fileBlock{Comments: tb.Doc, Comment: tb.Comment, Declaration: &declaration}
+	}
+
+	fb := encodeBlock(tb.Block)
+	fb.Comments = tb.Doc
+	fb.Comment = tb.Comment
+	fb.Tags = tb.Tags
+	fb.Weight = tb.Weight
+	return fb
+}
+
+func decodeBlock(fb fileBlock) (Block, error) {
+	b := Block{Comments: fb.EndComments}
+	for _, n := range(fb.Names) {
+		switch n := n.(type) {
+		case string:
+			b.Names = append(b.Names, n)
+		case map[string]interface{}:
+			child, err := decodeName(n)
+			if err != nil {
+				return b, err
+			}
+			b.Children = append(b.Children, child)
+		case map[interface{}]interface{}:
+			// YAML maps can have keys of any type.
+			m := make(map[string]interface{})
+			for k, v := range(n) {
+				m[fmt.Sprint(k)] = v
+			}
+			child, err := decodeName(m)
+			if err != nil {
+				return b, err
+			}
+			b.Children = append(b.Children, child)
+		default:
+			return b, fmt.Errorf("Not a valid name: %v", n)
+		}
+	}
+
+	for _, fc := range(fb.Blocks) {
+		if fc.Include != "" {
+			b.Children = append(b.Children, TaggedBlock{
+				Doc: fc.Comments,
+				Comment: fc.Comment,
+				Include: fc.Include,
+			})
+			continue
+		}
+		if fc.Declaration != nil {
+			b.Children = append(b.Children, TaggedBlock{
+				Doc: fc.Comments,
+				Comment: fc.Comment,
+				Declaration: *fc.Declaration,
+			})
+			continue
+		}
+
+		child, err := decodeBlock(fc)
+		if err != nil {
+			return b, err
+		}
+		if fc.Weight < 0 {
+			return b, fmt.Errorf("Not a valid weight: %v", fc.Weight)
+		}
+		b.Children = append(b.Children, TaggedBlock{
+			Tags: nonNil(fc.Tags),
+			Weight: fc.Weight,
+			Doc: fc.Comments,
+			Comment: fc.Comment,
+			Block: child,
+		})
+	}
+
+	return b, nil
+}
+
+// Decodes a name with inline tags and/or a weight into a tagged block.
+func decodeName(m map[string]interface{}) (TaggedBlock, error) {
+	name, ok := m["name"].(string)
+	if !ok {
+		return TaggedBlock{}, fmt.Errorf("Name is missing or not a string: %v", m)
+	}
+
+	tb := TaggedBlock{
+		Inline: true,
+		Block: Block{
+			Names: []string{name},
+		},
+	}
+
+	if tags, ok := m["tags"]; ok {
+		list, ok := tags.([]interface{})
+		if !ok {
+			return tb, fmt.Errorf("Tags for %s are not a list", name)
+		}
+		tb.Tags = []string{}
+		for _, tag := range(list) {
+			tb.Tags = append(tb.Tags, fmt.Sprint(tag))
+		}
+	}
+
+	if comments, ok := m["comments"]; ok {
+		list, ok := comments.([]interface{})
+		if !ok {
+			return tb, fmt.Errorf("Comments for %s are not a list", name)
+		}
+		for _, comment := range(list) {
+			tb.Doc = append(tb.Doc, fmt.Sprint(comment))
+		}
+	}
+
+	if comment, ok := m["comment"]; ok {
+		s, ok := comment.(string)
+		if !ok {
+			return tb, fmt.Errorf("Comment for %s is not a string", name)
+		}
+		tb.Comment = s
+	}
+
+	if weight, ok := m["weight"]; ok {
+		switch w := weight.(type) {
+		case float64:
+			tb.Weight = w
+		case int:
+			tb.Weight = float64(w)
+		default:
+			return tb, fmt.Errorf("Weight for %s is not a number", name)
+		}
+		if tb.Weight <= 0 {
+			return tb, fmt.Errorf("Weight for %s must be positive", name)
+		}
+	}
+
+	return tb, nil
+}
+
+// Tags parsed from .names files are never nil, so blocks decoded from other
+// formats compare equal.
+func nonNil(tags []string) []string {
+	if tags == nil {
+		return []string{}
+	}
+	return tags
+}
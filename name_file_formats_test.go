@@ -0,0 +1,176 @@
+package names
+
+import (
+	"fmt"
+	"sort"
+	. "testing"
+)
+
+// Returns every entry in a block, sorted so that blocks with the same names
+// and tags (but possibly in a different order) compare equal.
+func blockEntries(b Block) []string {
+	out := make(chan Entry)
+	go func() {
+		defer close(out)
+		var tags TagStack
+		sendNamesInBlock(b, tags, 1, out)
+	}()
+
+	var entries []string
+	for entry := range(out) {
+		entries = append(entries, fmt.Sprint(entry))
+	}
+	sort.Strings(entries)
+	return entries
+}
+
+func readTestBlock(t *T, filename string) Block {
+	block, err := ReadBlock(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return block
+}
+
+func TestFormatOf(t *T) {
+	assertEquals(t, NamesFormat, FormatOf("test.names"))
+	assertEquals(t, JSONFormat, FormatOf("test.names.json"))
+	assertEquals(t, YAMLFormat, FormatOf("test.names.yaml"))
+	assertEquals(t, YAMLFormat, FormatOf("TEST.YML"))
+}
+
+func TestReadJSON(t *T) {
+	assertEquals(t,
+		blockEntries(readTestBlock(t, "test.names")),
+		blockEntries(readTestBlock(t, "testdata/test.names.json")))
+}
+
+func TestReadYAML(t *T) {
+	assertEquals(t,
+		blockEntries(readTestBlock(t, "test.names")),
+		blockEntries(readTestBlock(t, "testdata/test.names.yaml")))
+}
+
+func TestReadInvalidJSON(t *T) {
+	_, err := parseJSON([]byte(`{"names": [{"tags": ["No Name"]}]}`))
+	if err == nil {
+		t.Error("Parsing a name without a name should have failed.")
+	}
+
+	_, err = parseJSON([]byte(`{"names": [{"name": "John", "weight": -1}]}`))
+	if err == nil {
+		t.Error("Parsing a negative weight should have failed.")
+	}
+
+	_, err = parseJSON([]byte(`{"names": [42]}`))
+	if err == nil {
+		t.Error("Parsing a number as a name should have failed.")
+	}
+}
+
+func TestConvertInvalidNames(t *T) {
+	block, err := parseJSON([]byte(`{"blocks": [
+  {
+    "comments": ["Not a comment"],
+    "tags": ["Male:first", "era=19{50}s", "Boulder"],
+    "names": ["John /* Smith", {"name": "Jane", "tags": ["Las Vegas, Nevada"]}]
+  },
+  {"include": "a\\b.names"},
+  {"declare": {"kind": "tag", "tag": "USA", "tags": ["Nevada", "{Reno}"]}}
+]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = MarshalBlock(block, NamesFormat)
+	assertEquals(t, Errors{
+		fmt.Errorf(`Not a valid comment for a .names file: "Not a comment"`),
+		fmt.Errorf(`Not a valid tag for a .names file: "Male:first"`),
+		fmt.Errorf(`Not a valid tag for a .names file: "era=19{50}s"`),
+		fmt.Errorf(`Not a valid name for a .names file: "John /* Smith"`),
+		fmt.Errorf(`Not a valid tag for a .names file: "Las Vegas, Nevada"`),
+		fmt.Errorf(`Not a valid tag for a .names file: "{Reno}"`),
+	}, err)
+
+	// Anything that can be parsed from a .names file can be written to one.
+	_, err = MarshalBlock(readTestBlock(t, "testdata/test.names.json"), NamesFormat)
+	assertEquals(t, nil, err)
+}
+
+func TestEncodeBlock(t *T) {
+	block := parseTestBuffer(t, `
+		John Smith
+		Kojak *2: Dog
+		// The Free Zone.
+		Boulder, Male *10 {
+			Stuart Redman
+			Harold Lauder
+		}
+		// The end.`)
+
+	assertEquals(t, fileBlock{
+		Names: []interface{}{
+			"John Smith",
+			fileName{Name: "Kojak", Tags: []string{"Dog"}, Weight: 2},
+		},
+		Blocks: []fileBlock{
+			fileBlock{
+				Comments: []string{"// The Free Zone."},
+				Tags: []string{"Boulder", "Male"},
+				Weight: 10,
+				Names: []interface{}{"Stuart Redman", "Harold Lauder"},
+			},
+		},
+		EndComments: []string{"// The end."},
+	}, encodeBlock(block))
+}
+
+func TestJSONComments(t *T) {
+	block := parseTestBuffer(t, `
+		// A dog.
+		Kojak: Dog // Good boy.
+		// The Free Zone.
+		Boulder {
+			Stuart Redman /* Stu. */
+		} // Colorado.
+		// The end.`)
+
+	data, err := MarshalBlock(block, JSONFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := parseJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEquals(t, block, decoded)
+}
+
+func TestRoundTrip(t *T) {
+	for _, filename := range([]string{"test.names", "Steven King.names", "testdata/weights.names"}) {
+		original := readTestBlock(t, filename)
+		for _, format := range([]Format{JSONFormat, YAMLFormat, NamesFormat}) {
+			data, err := MarshalBlock(original, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var block Block
+			switch format {
+			case JSONFormat:
+				block, err = parseJSON(data)
+			case YAMLFormat:
+				block, err = parseYAML(data)
+			case NamesFormat:
+				block = parseTestBuffer(t, string(data))
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !assertEquals(t, blockEntries(original), blockEntries(block)) {
+				t.Logf("%s as %s:\n%s", filename, format, data)
+			}
+		}
+	}
+}
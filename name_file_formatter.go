@@ -0,0 +1,193 @@
+package names
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Formats the contents of a .names file canonically: names and blocks keep
+// their order (unless sorted is true) and their comments, nested blocks are
+// separated by blank lines, everything is indented with tabs, and tags are
+// separated by ", ". Files with syntax errors are not formatted.
+func FormatNames(src []byte, sorted bool) ([]byte, error) {
+	block, errs := parseBuffer(src)
+	if len(errs) > 0 {
+		return nil, parseErrors("", errs)
+	}
+
+	if sorted {
+		block = sortBlock(block)
+	}
+	return []byte(formatBlock(block)), nil
+}
+
+// Formats a block as the contents of a .names file.
+func formatBlock(b Block) string {
+	var buf bytes.Buffer
+	writeBlockContents(&buf, b, 0)
+	return buf.String()
+}
+
+func writeBlockContents(buf *bytes.Buffer, b Block, depth int) {
+	indent := strings.Repeat("\t", depth)
+	empty := true
+
+	// Blocks are separated from anything around them by a blank line.
+	afterBlock := false
+	separate := func(isBlock bool) {
+		if !empty && (isBlock || afterBlock) {
+			buf.WriteString("\n")
+		}
+		empty = false
+		afterBlock = isBlock
+	}
+
+	for _, name := range(b.Names) {
+		separate(false)
+		buf.WriteString(indent + name + "\n")
+	}
+
+	for _, child := range(b.Children) {
+		separate(isBlock(child))
+		writeComments(buf, child.Doc, indent)
+
+		// Ends the child's (last) line, after its comment if it has one.
+		endLine := "\n"
+		if child.Comment != "" {
+			endLine = " " + child.Comment + "\n"
+		}
+
+		if child.Declaration.Kind != "" {
+			buf.WriteString(indent + child.Declaration.String() + endLine)
+			continue
+		}
+
+		if child.Include != "" {
+			// Paths are written as they are, since they're read that way
+			// (they can't contain quotes or newlines).
+			buf.WriteString(indent + "include \"" + child.Include + "\"" + endLine)
+			continue
+		}
+
+		if child.Inline {
+			buf.WriteString(indent + child.Names[0])
+			if child.Weight != 0 {
+				buf.WriteString(" " + formatWeight(child.Weight))
+			}
+			if len(child.Tags) > 0 {
+				buf.WriteString(": " + strings.Join(child.Tags, ", "))
+			}
+			buf.WriteString(endLine)
+			continue
+		}
+
+		buf.WriteString(indent)
+		if len(child.Tags) > 0 {
+			buf.WriteString(strings.Join(child.Tags, ", ") + " ")
+		}
+		if child.Weight != 0 {
+			buf.WriteString(formatWeight(child.Weight) + " ")
+		}
+
+		if isEmpty(child.Block) {
+			buf.WriteString("{}" + endLine)
+			continue
+		}
+		buf.WriteString("{\n")
+		writeBlockContents(buf, child.Block, depth+1)
+		buf.WriteString(indent + "}" + endLine)
+	}
+
+	if len(b.Comments) > 0 {
+		separate(false)
+		writeComments(buf, b.Comments, indent)
+	}
+}
+
+// Writes comments on their own lines. Only the first line of a block comment
+// is indented, since the rest of it is written exactly as it was.
+func writeComments(buf *bytes.Buffer, comments []string, indent string) {
+	for _, comment := range(comments) {
+		buf.WriteString(indent + comment + "\n")
+	}
+}
+
+// Checks whether a child of a block is actually a block, rather than a name or
+// a statement.
+func isBlock(tb TaggedBlock) bool {
+	return !tb.Inline && tb.Include == "" && tb.Declaration.Kind == ""
+}
+
+// Checks whether a child of a block is a name without any tags, weight or
+// comments, which can be written as a plain name.
+func isPlainName(tb TaggedBlock) bool {
+	return tb.Inline && len(tb.Tags) == 0 && tb.Weight == 0 && len(tb.Doc) == 0 && tb.Comment == ""
+}
+
+func formatWeight(weight float64) string {
+	return "*" + strconv.FormatFloat(weight, 'f', -1, 64)
+}
+
+func isEmpty(b Block) bool {
+	return len(b.Names) == 0 && len(b.Children) == 0 && len(b.Comments) == 0
+}
+
+// Returns a copy of a block with its names and nested blocks sorted
+// (recursively). Plain names come first, then tag declarations, include
+// statements (sorted by path), names with inline tags, weights or comments
+// (sorted by name), and then blocks (sorted by their tags).
+func sortBlock(b Block) Block {
+	sorted := Block{
+		Names: append([]string(nil), b.Names...),
+		Comments: b.Comments,
+	}
+
+	for _, child := range(b.Children) {
+		if isPlainName(child) {
+			sorted.Names = append(sorted.Names, child.Names[0])
+			continue
+		}
+		if isBlock(child) {
+			child.Block = sortBlock(child.Block)
+		}
+		sorted.Children = append(sorted.Children, child)
+	}
+
+	sort.Strings(sorted.Names)
+	sort.SliceStable(sorted.Children, func(i, j int) bool {
+		a, b := sorted.Children[i], sorted.Children[j]
+		if sortRank(a) != sortRank(b) {
+			return sortRank(a) < sortRank(b)
+		}
+		return sortKey(a) < sortKey(b)
+	})
+
+	return sorted
+}
+
+func sortRank(tb TaggedBlock) int {
+	switch {
+	case tb.Declaration.Kind != "":
+		return 0
+	case tb.Include != "":
+		return 1
+	case tb.Inline:
+		return 2
+	}
+	return 3
+}
+
+func sortKey(tb TaggedBlock) string {
+	if tb.Declaration.Kind != "" {
+		return tb.Declaration.String()
+	}
+	if tb.Include != "" {
+		return tb.Include
+	}
+	if tb.Inline {
+		return tb.Names[0]
+	}
+	return strings.Join(tb.Tags, ", ")
+}
@@ -0,0 +1,164 @@
+package names
+
+import (
+	"io/ioutil"
+	. "testing"
+)
+
+func formatTestNames(t *T, src string, sorted bool) string {
+	formatted, err := FormatNames([]byte(src), sorted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(formatted)
+}
+
+func TestFormatBlock(t *T) {
+	assertEquals(t, `John Smith
+
+Just Foo {
+	Jane Doe
+	J.R.R. Tolkein: Classic, Fantasy
+
+	Bar, Fizz *2 {
+		Buzz {}
+	}
+}
+
+Kojak *0.5
+`, formatTestNames(t, `
+		John Smith
+		Just Foo{Jane Doe
+		J.R.R. Tolkein:Classic,Fantasy
+		Bar,Fizz *2 { Buzz {} }}
+		Kojak*0.5`, false))
+}
+
+func TestFormatComments(t *T) {
+	assertEquals(t, `// Names.
+William Wallace
+
+// More names.
+Tag {
+	/* Inside
+	   a block. */
+	John Smith
+	// The end of the block.
+}
+
+// The end of the file.
+`, formatTestNames(t, `// Names.
+William Wallace
+// More names.
+Tag {
+    /* Inside
+	   a block. */
+    John Smith
+// The end of the block.
+}
+// The end of the file.`, false))
+}
+
+func TestFormatTrailingComments(t *T) {
+	// Comments at the end of a line stay with the name or block on that line,
+	// rather than moving to whatever follows.
+	formatted := `John Smith // author of X
+Jane Doe
+
+// Names.
+Tag {
+	Kojak: Dog /* Good boy. */
+} // Tag.
+
+include "more.names" // More.
+`
+	assertEquals(t, formatted, formatTestNames(t, `John Smith   // author of X
+ Jane Doe
+// Names.
+Tag {
+Kojak:Dog /* Good boy. */ }  // Tag.
+include "more.names" // More.`, false))
+	assertEquals(t, formatted, formatTestNames(t, formatted, false))
+
+	block := parseTestBuffer(t, formatted)
+	assertEquals(t, "// author of X", block.Children[0].Comment)
+	assertEquals(t, []string(nil), block.Children[1].Doc)
+}
+
+func TestFormatKeepsFileHeader(t *T) {
+	src, err := ioutil.ReadFile("test.names")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEquals(t, string(src), formatTestNames(t, string(src), false))
+}
+
+func TestFormatTagDeclarations(t *T) {
+	assertEquals(t, `tag Nevada > Las Vegas, Reno
+alias M, Man = Male
+
+Las Vegas {
+	Lloyd Henreid: M
+}
+`, formatTestNames(t, `tag Nevada>Las Vegas,Reno
+alias M,Man=Male
+Las Vegas { Lloyd Henreid: M }`, false))
+}
+
+func TestFormatSorted(t *T) {
+	assertEquals(t, `Abagail
+Zed
+Kojak: Dog
+
+Boulder {
+	Glen Bateman
+	Stuart Redman
+	Kojak: Animal
+	Zed *2
+}
+
+Las Vegas {
+	Lloyd Henreid
+	Randall Flagg
+}
+`, formatTestNames(t, `
+Zed
+Las Vegas {
+	Randall Flagg
+	Lloyd Henreid
+}
+Boulder {
+	Zed *2
+	Stuart Redman
+	Glen Bateman
+	Kojak: Animal
+}
+Abagail
+Kojak: Dog`, true))
+}
+
+func TestFormatIsIdempotent(t *T) {
+	for _, filename := range([]string{"test.names", "Steven King.names", "testdata/weights.names"}) {
+		src, err := ioutil.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, sorted := range([]bool{false, true}) {
+			once := formatTestNames(t, string(src), sorted)
+			assertEquals(t, once, formatTestNames(t, once, sorted))
+
+			// Formatting never changes the names in the file.
+			assertEquals(t,
+				blockEntries(parseTestBuffer(t, string(src))),
+				blockEntries(parseTestBuffer(t, once)))
+		}
+	}
+}
+
+func TestFormatSyntaxErrors(t *T) {
+	_, err := FormatNames([]byte("John Smith\n}"), false)
+	assertEquals(t, Errors{
+		ParseError{Line: 2, Column: 1, Text: "}"},
+	}, err)
+}
@@ -0,0 +1,100 @@
+package names
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// An error loading a file included by a name file, reported at the include
+// statement.
+type IncludeError struct {
+	Filename string
+	Line int
+	Column int
+
+	// The path being included, as it was written.
+	Include string
+
+	Err error
+}
+
+func (e IncludeError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: include %q: %v", e.Filename, e.Include, e.Err)
+	}
+	return fmt.Sprintf("%s:%d:%d: include %q: %v",
+		e.Filename, e.Line, e.Column, e.Include, e.Err)
+}
+
+// Returned (inside an IncludeError) when a file ends up including itself.
+type IncludeCycleError []string
+
+func (e IncludeCycleError) Error() string {
+	return "include cycle: " + strings.Join(e, " -> ")
+}
+
+// Loads the files included by a block (and any files they include) into their
+// include statements' blocks. Included paths are relative to the including
+// file. The chain is the files currently being included, starting with the
+// file the block is from, and is used to detect cycles.
+func resolveIncludes(b *Block, filename string, chain []string) Errors {
+	var errs Errors
+	for i := range(b.Children) {
+		child := &b.Children[i]
+		if child.Include == "" {
+			errs = append(errs, resolveIncludes(&child.Block, filename, chain)...)
+			continue
+		}
+
+		fail := func(err error) {
+			errs = append(errs, IncludeError{
+				Filename: filename,
+				Line: child.line,
+				Column: child.column,
+				Include: child.Include,
+				Err: err,
+			})
+		}
+
+		path := child.Include
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(filename), path)
+		}
+
+		if isIncluded(path, chain) {
+			fail(IncludeCycleError(append(append([]string(nil), chain...), path)))
+			continue
+		}
+
+		block, err := ReadBlock(path)
+		if _, ok := err.(Errors); err != nil && !ok {
+			fail(err)
+			continue
+		}
+		errs = appendErrors(errs, err)
+
+		errs = append(errs, resolveIncludes(&block, path, append(chain, path))...)
+		child.Block = block
+	}
+	return errs
+}
+
+// Checks whether a file is already in a chain of includes.
+func isIncluded(filename string, chain []string) bool {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		abs = filepath.Clean(filename)
+	}
+
+	for _, f := range(chain) {
+		other, err := filepath.Abs(f)
+		if err != nil {
+			other = filepath.Clean(f)
+		}
+		if abs == other {
+			return true
+		}
+	}
+	return false
+}
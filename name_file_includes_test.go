@@ -0,0 +1,125 @@
+package names
+
+import (
+	"fmt"
+	"os"
+	. "testing"
+)
+
+// Returns the first name entries from a name file (with their tags and
+// weights), and any error.
+func includeTestEntries(filename string) ([]string, error) {
+	entries, err := parseNameFile(filename)
+
+	var names []string
+	for entry := range(entries) {
+		if entry.Type == "first" {
+			names = append(names, fmt.Sprintf("%s %v %g", entry.Name, entry.Tags, entry.Weight))
+		}
+	}
+	return names, err
+}
+
+func TestParseInclude(t *T) {
+	assertEquals(t, Block{
+		Children: []TaggedBlock{
+			TaggedBlock{
+				Tags: []string{"Boulder"},
+				Block: Block{
+					Children: []TaggedBlock{
+						TaggedBlock{Include: "common.names", offset: 11, line: 2, column: 2},
+						TaggedBlock{
+							Doc: []string{"// More."},
+							Include: "../more.names",
+							offset: 45,
+							line: 4,
+							column: 2,
+						},
+					},
+				},
+			},
+		},
+	}, parseTestBuffer(t, `Boulder {
+	include "common.names"
+	// More.
+	@import "../more.names"
+}`))
+}
+
+func TestIncludedNamesInheritTags(t *T) {
+	names, err := includeTestEntries("testdata/include/main.names")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEquals(t, []string{
+		"Stuart [Boulder] 1",
+		"Smith [Boulder] 1",
+		"Jones [Boulder Male] 1",
+		"Lloyd [Las Vegas] 2",
+		"Smith [Las Vegas] 2",
+		"Jones [Las Vegas Male] 2",
+	}, names)
+}
+
+func TestIncludeCycle(t *T) {
+	names, err := includeTestEntries("testdata/include/cycle.names")
+	assertEquals(t, []string{"Andros [Tag] 1"}, names)
+	assertEquals(t,
+		"testdata/include/cycle2.names:2:1: include \"cycle.names\": include cycle: "+
+			"testdata/include/cycle.names -> testdata/include/cycle2.names -> testdata/include/cycle.names",
+		err.Error())
+}
+
+func TestIncludeMissingFile(t *T) {
+	names, err := includeTestEntries("testdata/include/missing.names")
+	assertEquals(t, []string{"John [] 1"}, names)
+
+	errs, ok := err.(Errors)
+	if !ok || len(errs) != 1 {
+		t.Fatalf("Expected 1 error, got %v", err)
+	}
+	e, ok := errs[0].(IncludeError)
+	if !ok {
+		t.Fatalf("Expected an IncludeError, got %v", errs[0])
+	}
+	assertEquals(t, "testdata/include/missing.names", e.Filename)
+	assertEquals(t, 2, e.Line)
+	assertEquals(t, 2, e.Column)
+	if !os.IsNotExist(e.Err) {
+		t.Errorf("Expected a file not found error, got %v", e.Err)
+	}
+}
+
+func TestIncludePositionWithCRLF(t *T) {
+	block := parseTestBuffer(t, "// Windows.\r\nJohn\r\n\tinclude \"absent.names\"\r\n")
+	errs := resolveIncludes(&block, "testdata/include/crlf.names", []string{"testdata/include/crlf.names"})
+	if len(errs) != 1 {
+		t.Fatalf("Expected 1 error, got %v", errs)
+	}
+	e := errs[0].(IncludeError)
+	assertEquals(t, 3, e.Line)
+	assertEquals(t, 2, e.Column)
+}
+
+func TestFormatIncludeWithBackslash(t *T) {
+	src := "include \"surnames\\common.names\"\n"
+	assertEquals(t, src, formatTestNames(t, src, false))
+	assertEquals(t, src, formatTestNames(t, formatTestNames(t, src, false), false))
+	assertEquals(t, `surnames\common.names`, parseTestBuffer(t, src).Children[0].Include)
+}
+
+func TestFormatInclude(t *T) {
+	assertEquals(t, `Stuart
+include "common.names"
+
+Male {
+	// More names.
+	include "more.names"
+}
+`, formatTestNames(t, `Stuart
+@import "common.names"
+Male {
+// More names.
+include "more.names" }`, false))
+}
@@ -1,10 +1,13 @@
-package main
+package names
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
-	"os"
+	"regexp"
+	"sort"
 	"strings"
+	"unicode/utf8"
 
 	p "github.com/prataprc/goparsec"
 )
@@ -16,19 +19,69 @@ import (
 type Block struct {
 	Names []string
 	Children []TaggedBlock
+
+	// Comments at the end of the block, after all of its names and nested
+	// blocks. Comments before a name or block are attached to it instead (as
+	// its Doc).
+	Comments []string
+
+	// Offsets of any unexpected input that was skipped over while parsing
+	// the block.
+	errors []int
 }
 
 func (b Block) String() string {
 	return fmt.Sprintf("{Names: %v Children: %v}", b.Names, b.Children)
 }
 
-// A block with tags that apply to all of its contents.
+// A block with tags (and optionally a weight) that apply to all of its
+// contents.
 type TaggedBlock struct {
+	// Plain tags ("Boulder") and key/value tags ("era=1950s").
 	Tags []string
+
+	// Multiplies the weight of every name in the block. Zero if the block
+	// doesn't have a weight.
+	Weight float64
+
+	// Whether this is actually just a single name with inline tags and/or a
+	// weight ("John Smith *50: Tag1, Tag2").
+	Inline bool
+
+	// Any comments directly before the block or name, in order.
+	Doc []string
+
+	// A comment at the end of the line the name (or the block's closing
+	// brace) is on.
+	Comment string
+
+	// If set, this is an include statement (include "other.names") rather
+	// than a block, and the block holds the contents of the included file once
+	// it has been loaded.
+	Include string
+
+	// Offset of the include statement in its file, and its line and column
+	// (which are set once the whole file is parsed), for reporting errors.
+	offset int
+	line, column int
+
+	// If set (if its Kind isn't empty), this is a tag declaration rather than
+	// a block.
+	Declaration TagDeclaration
+
 	Block
 }
 
 func (tb TaggedBlock) String() string {
+	if tb.Declaration.Kind != "" {
+		return tb.Declaration.String()
+	}
+	if tb.Include != "" {
+		return fmt.Sprintf("Include: %q %v", tb.Include, tb.Block)
+	}
+	if tb.Weight != 0 {
+		return fmt.Sprintf("Tags: %v Weight: %v %v", tb.Tags, tb.Weight, tb.Block)
+	}
 	return fmt.Sprintf("Tags: %v %v", tb.Tags, tb.Block)
 }
 
@@ -37,6 +90,63 @@ type Entry struct {
 	Name string
 	Type string
 	Tags []string
+
+	// Values of key/value tags ("era=1950s"). If a key is given more than once
+	// (e.g. by nested blocks, in any case), the innermost value is used.
+	Attributes map[string]string
+
+	// How likely the name is to be picked, relative to other names. This is
+	// the name's own weight multiplied by the weight of every block it is in,
+	// which default to 1.
+	Weight float64
+
+	// If set, the weight is how often the name occurs (like a count from a
+	// name table), so the weights of every entry for a name are added up.
+	Frequency bool
+
+	// If set (if its Kind isn't empty), this isn't a name but a tag
+	// declaration, which applies to every name regardless of where it is.
+	Declaration TagDeclaration
+}
+
+// A syntax error in a name file.
+type ParseError struct {
+	Filename string
+	Line, Column int
+
+	// The unexpected input.
+	Text string
+}
+
+func (e ParseError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: unexpected '%s'",
+		e.Filename, e.Line, e.Column, e.Text)
+}
+
+// A list of errors that are reported together, like all of the syntax errors
+// in a name file (each a ParseError), or all of the errors from loading a set of
+// name files.
+type Errors []error
+
+func (es Errors) Error() string {
+	msgs := make([]string, len(es))
+	for i, e := range(es) {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Returns the syntax errors in a file as Errors, or nil if there aren't any.
+func parseErrors(filename string, errs []ParseError) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	list := make(Errors, len(errs))
+	for i, e := range(errs) {
+		e.Filename = filename
+		list[i] = e
+	}
+	return list
 }
 
 // Tracks sets of tags in a push/pop stack.
@@ -83,72 +193,227 @@ func (stack TagStack) Tags() []string {
 
 // Entry Point
 
-func parseNameFiles(filenames []string) (<-chan Entry) {
+// Parses all of the specified name files, returning their entries. Files with
+// syntax errors are parsed as far as possible, and every error from every file
+// (including files that couldn't be read) is returned.
+func parseNameFiles(filenames []string) (<-chan Entry, error) {
+	sources := make([]Source, len(filenames))
+	for i, filename := range(filenames) {
+		sources[i] = NameFile(filename)
+	}
+	return loadSources(sources)
+}
+
+// Parses a single name file, along with any files it includes. If the file
+// can't be read, no entries are returned; if it (or an included file) has
+// errors, the entries that could be parsed are returned along with them.
+func parseNameFile(filename string) (<-chan Entry, error) {
+	block, err := ReadBlock(filename)
+	if _, ok := err.(Errors); err != nil && !ok {
+		return nil, err
+	}
+
+	if errs := resolveIncludes(&block, filename, []string{filename}); len(errs) > 0 {
+		err = appendErrors(appendErrors(nil, err), errs)
+	}
+
 	entries := make(chan Entry)
 
 	go func() {
 		defer close(entries)
-		for _, filename := range(filenames) {
-			for entry := range(parseNameFile(filename)) {
-				entries <- entry
-			}
-		}
+
+		var tags TagStack
+		sendNamesInBlock(block, tags, 1, entries)
 	}()
 
-	return entries
+	return entries, err
 }
 
-func parseNameFile(filename string) (<-chan Entry) {
+// Reads a name file in any of the supported formats (see FormatOf). If a
+// .names file has syntax errors, the block is parsed as far as possible and
+// returned along with a ParseError for each of them (as Errors).
+//
+// Include statements are not resolved, so their blocks are empty.
+func ReadBlock(filename string) (Block, error) {
 	buffer, err := ioutil.ReadFile(filename)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		return Block{}, err
 	}
 
-	block := parseBuffer(buffer)
+	switch FormatOf(filename) {
+	case JSONFormat:
+		block, err := parseJSON(buffer)
+		if err != nil {
+			return block, fmt.Errorf("%s: %v", filename, err)
+		}
+		return block, nil
+	case YAMLFormat:
+		block, err := parseYAML(buffer)
+		if err != nil {
+			return block, fmt.Errorf("%s: %v", filename, err)
+		}
+		return block, nil
+	}
 
-	entries := make(chan Entry)
+	block, errs := parseBuffer(buffer)
+	return block, parseErrors(filename, errs)
+}
 
-	go func() {
-		defer close(entries)
+func parseBuffer(buffer []byte) (Block, []ParseError) {
+	buffer = normalizeNewlines(buffer)
+	scanner := p.NewScanner(buffer)
 
-		var tags TagStack
-		sendNamesInBlock(block, tags, entries)
-	}()
+	// Unexpected input inside a block is skipped by parseBlockContents, so
+	// the only thing that can stop it early is an unmatched closing brace.
+	// These are skipped as well, so that any errors after them are also
+	// found.
+	var block Block
+	for {
+		result, s := parseBlockContents(scanner)
+		block = mergeBlocks(block, result.(Block))
+
+		brace, s := rbrace(s)
+		if brace == nil {
+			break
+		}
+		block.errors = append(block.errors, brace.(*p.Terminal).Position)
+		scanner = s
+	}
 
-	return entries
+	setIncludePositions(&block, buffer)
+
+	offsets := errorOffsets(block, nil)
+	sort.Ints(offsets)
+
+	var errs []ParseError
+	for _, offset := range(offsets) {
+		line, column := position(buffer, offset)
+		r, _ := utf8.DecodeRune(buffer[offset:])
+		errs = append(errs, ParseError{
+			Line: line,
+			Column: column,
+			Text: string(r),
+		})
+	}
+
+	return block, errs
 }
 
-func parseBuffer(buffer []byte) Block {
-	scanner := p.NewScanner(buffer)
-	result, _ := parseBlockContents(scanner)
-	return result.(Block)
+// Converts Windows line endings, so that files saved on Windows are parsed
+// the same as any other (and offsets in them are the same).
+func normalizeNewlines(buffer []byte) []byte {
+	return bytes.Replace(buffer, []byte("\r\n"), []byte("\n"), -1)
+}
+
+// Recursively collects the offsets of unexpected input skipped in a block and
+// its children.
+func errorOffsets(b Block, offsets []int) []int {
+	offsets = append(offsets, b.errors...)
+	for _, child := range(b.Children) {
+		offsets = errorOffsets(child.Block, offsets)
+	}
+	return offsets
+}
+
+// Sets the line and column of every include statement in a block and its
+// children.
+func setIncludePositions(b *Block, buffer []byte) {
+	for i := range(b.Children) {
+		child := &b.Children[i]
+		if child.Include != "" {
+			child.line, child.column = position(buffer, child.offset)
+		}
+		setIncludePositions(&child.Block, buffer)
+	}
+}
+
+// Converts an offset in a buffer to a (1-based) line and column.
+func position(buffer []byte, offset int) (line, column int) {
+	line, column = 1, 1
+	for _, r := range(string(buffer[0:offset])) {
+		if r == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+	return line, column
 }
 
 // Recursively iterates through names in this block, splitting them into
 // components and sending them to the output channel.
-func sendNamesInBlock(b Block, tags TagStack, out chan<- Entry) {
+func sendNamesInBlock(b Block, tags TagStack, weight float64, out chan<- Entry) {
 	for _, fullName := range(b.Names) {
 		for _, entry := range(fullNameToComponents(fullName)) {
-			entry.Tags = tags.Tags()
+			// The stack's backing array is reused as blocks are pushed and
+			// popped, so each entry needs its own copy of the tags.
+			entry.Tags, entry.Attributes = splitAttributes(tags.Tags())
+			entry.Weight = weight
 			out <- entry
 		}
 	}
 
 	for _, child := range(b.Children) {
+		if child.Declaration.Kind != "" {
+			out <- Entry{Declaration: child.Declaration}
+			continue
+		}
+
+		childWeight := weight
+		if child.Weight != 0 {
+			childWeight *= child.Weight
+		}
+
 		tags.Push(child.Tags...)
-		sendNamesInBlock(child.Block, tags, out)
+		sendNamesInBlock(child.Block, tags, childWeight, out)
 		tags.Pop()
 	}
 }
 
+// Separates key/value tags ("era=1950s") from plain tags. Keys are lower
+// case, and later values for the same key (in any case) replace earlier ones.
+func splitAttributes(tags []string) ([]string, map[string]string) {
+	plain := []string{}
+	var attributes map[string]string
+	for _, tag := range(tags) {
+		if i := strings.Index(tag, "="); i >= 0 {
+			if attributes == nil {
+				attributes = make(map[string]string)
+			}
+			attributes[strings.ToLower(tag[:i])] = tag[i+1:]
+		} else {
+			plain = append(plain, tag)
+		}
+	}
+	return plain, attributes
+}
+
+// Matches initials, like the "D." in "Charles D. Campion" or the "J.R.R." in
+// "J.R.R. Tolkein".
+var initialPattern = regexp.MustCompile(`^(\pL\.)+$`)
+
 // Breaks a full name into individual components, with their component type
 // (e.g. "first", "last", "nick").
 func fullNameToComponents(full string) []Entry {
 	var entries []Entry
 
-	comps := strings.Split(full, " ")
+	// The first name is the first component that isn't an initial (or a
+	// nickname), so "Edgar" is the first name in "J. Edgar Hoover".
+	named := false
+
+	comps := strings.Fields(full)
 	for i, c := range(comps) {
+		// Initials are only used when asked for, and don't count as any
+		// other name part.
+		if initialPattern.MatchString(c) {
+			entries = append(entries, Entry{
+				Name: c,
+				Type: "initial",
+			})
+			continue
+		}
+
 		// Nicknames are denoted by surrounding them with double quotes.
 		if strings.HasPrefix(c, "\"") && strings.HasSuffix(c, "\"") {
 			entries = append(entries, Entry{
@@ -159,9 +424,11 @@ func fullNameToComponents(full string) []Entry {
 		}
 
 		// Hyphenated names are broken into individual components.
+		first := !named && (i == 0 || i+1 < len(comps))
+		named = true
 		cs := strings.Split(c, "-")
 		for _, c2 := range(cs) {
-			if i == 0 {
+			if first {
 				entries = append(entries, Entry{
 					Name: c2,
 					Type: "first",
@@ -191,64 +458,218 @@ func fullNameToComponents(full string) []Entry {
 
 // Block Contents: the contents inside the curly braces of a block (not
 // including the curly braces). This can consist of names and tagged blocks.
+// Anything else (other than the closing brace) is skipped and recorded as an
+// error.
 func parseBlockContents(s p.Scanner) (p.ParsecNode, p.Scanner) {
 	entry := p.OrdChoice(func (ns []p.ParsecNode) p.ParsecNode {
 		return ns[0]
-	}, comment, parseTaggedBlock, parseName)
+	}, trailingComment, comment, p.Parser(parseInclude), p.Parser(parseDeclaration),
+		p.Parser(parseTaggedBlock), p.Parser(parseName), unexpected)
 
 	return p.Kleene(func (ns []p.ParsecNode) p.ParsecNode {
 		block := Block{}
-		for _, n := range(ns) {
-			if child, ok := n.(TaggedBlock); ok {
+		var doc []string
+		for i, n := range(ns) {
+			if t, ok := n.(*p.Terminal); ok && t.Name == "TRAILING_COMMENT" {
+				text := strings.TrimSpace(t.Value)
+				if i == 0 || !attachComment(&block, ns[i-1], text) {
+					doc = append(doc, text)
+				}
+			} else if child, ok := n.(TaggedBlock); ok {
+				child.Doc = doc
+				doc = nil
 				block.Children = append(block.Children, child)
 			} else if name, ok := n.(string); ok {
-				block.Names = append(block.Names, name)
+				if len(doc) == 0 && len(block.Children) == 0 {
+					block.Names = append(block.Names, name)
+					continue
+				}
+
+				// Names with comments, or after nested blocks, are kept in
+				// order with the blocks (as untagged inline names).
+				block.Children = append(block.Children, TaggedBlock{
+					Inline: true,
+					Doc: doc,
+					Block: Block{
+						Names: []string{name},
+					},
+				})
+				doc = nil
+			} else if t, ok := n.(*p.Terminal); ok && t.Name == "COMMENT" {
+				doc = append(doc, strings.TrimSpace(t.Value))
+			} else if t, ok := n.(*p.Terminal); ok && t.Name == "UNEXPECTED" {
+				block.errors = append(block.errors, t.Position)
 			}
 		}
+		block.Comments = doc
 		return block
 	}, entry)(s)
 }
 
-// A series of tags followed by a block, delimited by curly braces.
+// Attaches a comment to the name or block before it on the same line. Returns
+// false if there isn't one (if the comment follows another comment).
+func attachComment(b *Block, prev p.ParsecNode, comment string) bool {
+	switch prev.(type) {
+	case TaggedBlock:
+	case string:
+		// Plain names have to become inline names to have a comment.
+		if len(b.Children) == 0 {
+			last := b.Names[len(b.Names)-1]
+			if b.Names = b.Names[:len(b.Names)-1]; len(b.Names) == 0 {
+				b.Names = nil
+			}
+			b.Children = append(b.Children, TaggedBlock{
+				Inline: true,
+				Block: Block{
+					Names: []string{last},
+				},
+			})
+		}
+	default:
+		return false
+	}
+	b.Children[len(b.Children)-1].Comment = comment
+	return true
+}
+
+// An include statement, like include "Common Surnames.names" (or @import
+// "Common Surnames.names").
+func parseInclude(s p.Scanner) (p.ParsecNode, p.Scanner) {
+	n, s2 := include(s)
+	if t, ok := n.(*p.Terminal); ok {
+		path := t.Value[strings.Index(t.Value, `"`)+1 : len(t.Value)-1]
+		return TaggedBlock{Include: path, offset: t.Position}, s2
+	}
+	return nil, s
+}
+
+// A tag hierarchy ("tag Nevada > Las Vegas, Reno") or alias ("alias M =
+// Male") declaration.
+func parseDeclaration(s p.Scanner) (p.ParsecNode, p.Scanner) {
+	hierarchy := p.And(func (ns []p.ParsecNode) p.ParsecNode {
+		return TaggedBlock{
+			Declaration: TagDeclaration{
+				Kind: "tag",
+				Tag: string(ns[1].(Tag)),
+				Tags: ns[3].([]string),
+			},
+		}
+	}, tagKeyword, p.Parser(tag), gt, someTags)
+
+	alias := p.And(func (ns []p.ParsecNode) p.ParsecNode {
+		return TaggedBlock{
+			Declaration: TagDeclaration{
+				Kind: "alias",
+				Tag: string(ns[3].(Tag)),
+				Tags: ns[1].([]string),
+			},
+		}
+	}, aliasKeyword, someTags, equals, p.Parser(tag))
+
+	return p.OrdChoice(func (ns []p.ParsecNode) p.ParsecNode {
+		return ns[0]
+	}, hierarchy, alias)(s)
+}
+
+// A series of tags, optionally followed by a weight, and then a block
+// delimited by curly braces ("Boulder, Male *10 { ... }").
 func parseTaggedBlock(s p.Scanner) (p.ParsecNode, p.Scanner) {
-	return p.And(func (ns []p.ParsecNode) p.ParsecNode {
+	withWeight := p.And(func (ns []p.ParsecNode) p.ParsecNode {
+		return TaggedBlock{
+			Tags: ns[0].([]string),
+			Weight: ns[1].(float64),
+			Block: ns[3].(Block),
+		}
+	}, tags, p.Parser(weight), lbrace, p.Parser(parseBlockContents), rbrace)
+
+	withoutWeight := p.And(func (ns []p.ParsecNode) p.ParsecNode {
 		return TaggedBlock{
 			Tags: ns[0].([]string),
 			Block: ns[2].(Block),
 		}
-	}, tags, lbrace, parseBlockContents, rbrace)(s)
+	}, tags, lbrace, p.Parser(parseBlockContents), rbrace)
+
+	return p.OrdChoice(func (ns []p.ParsecNode) p.ParsecNode {
+		return ns[0]
+	}, withWeight, withoutWeight)(s)
 }
 
-// A single name, potentially tagged inline ("John Smith:tag1, tag2").
+// A single name, potentially weighted ("John Smith *50") and/or tagged inline
+// ("John Smith *50: tag1, tag2").
 func parseName(s p.Scanner) (p.ParsecNode, p.Scanner) {
+	// Inline tags and weights are just shorthand for a tagged block with a
+	// single name.
+	withWeightAndTags := p.And(func (ns []p.ParsecNode) p.ParsecNode {
+		return TaggedBlock{
+			Tags: ns[3].([]string),
+			Weight: ns[1].(float64),
+			Inline: true,
+			Block: Block{
+				Names: []string{ns[0].(string)},
+			},
+		}
+	}, name, p.Parser(weight), colon, tags)
+
 	withTags := p.And(func (ns []p.ParsecNode) p.ParsecNode {
-		// Inline tags are just shorthand for a tagged block with a single
-		// name.
 		return TaggedBlock{
 			Tags: ns[2].([]string),
+			Inline: true,
 			Block: Block{
 				Names: []string{ns[0].(string)},
 			},
 		}
 	}, name, colon, tags)
 
+	withWeight := p.And(func (ns []p.ParsecNode) p.ParsecNode {
+		return TaggedBlock{
+			Weight: ns[1].(float64),
+			Inline: true,
+			Block: Block{
+				Names: []string{ns[0].(string)},
+			},
+		}
+	}, name, p.Parser(weight))
+
 	return p.OrdChoice(func (ns []p.ParsecNode) p.ParsecNode {
 		return ns[0]
-	}, withTags, name)(s)
+	}, withWeightAndTags, withTags, withWeight, name)(s)
 }
 
-// A list of comma-delimited tags.
+// A list of comma-delimited tags, which can be key/value tags.
 var tags = p.Kleene(func (ns []p.ParsecNode) p.ParsecNode {
 	ts := make([]string, len(ns))
 	for i, n := range(ns) {
 		ts[i] = string(n.(Tag))
 	}
 	return ts
-}, tag, comma)
+}, p.Parser(parseTagOrAttribute), comma)
+
+// A plain tag ("Boulder") or a key/value tag ("era=1950s"), which is kept as
+// a single tag until the entries are created.
+func parseTagOrAttribute(s p.Scanner) (p.ParsecNode, p.Scanner) {
+	attribute := p.And(func (ns []p.ParsecNode) p.ParsecNode {
+		return Tag(fmt.Sprintf("%s=%s", ns[0].(string), ns[2].(Tag)))
+	}, attributeKey, equals, p.Parser(tag))
+
+	return p.OrdChoice(func (ns []p.ParsecNode) p.ParsecNode {
+		return ns[0]
+	}, attribute, p.Parser(tag))(s)
+}
+
+// At least one tag, comma-delimited.
+var someTags = p.Many(func (ns []p.ParsecNode) p.ParsecNode {
+	ts := make([]string, len(ns))
+	for i, n := range(ns) {
+		ts[i] = string(n.(Tag))
+	}
+	return ts
+}, p.Parser(tag), comma)
 
 func mergeBlocks(a, b Block) Block {
 	return Block{
 		Names: append(a.Names, b.Names...),
 		Children: append(a.Children, b.Children...),
+		Comments: append(a.Comments, b.Comments...),
+		errors: append(a.errors, b.errors...),
 	}
 }
@@ -1,23 +1,215 @@
-package main
+package names
 
 import (
+	"os"
 	. "testing"
 )
 
+// Parses a name file from a string, failing the test on any syntax errors.
+func parseTestBuffer(t *T, text string) Block {
+	block, errs := parseBuffer([]byte(text))
+	if len(errs) > 0 {
+		t.Error(errs)
+	}
+	return block
+}
+
 func TestParseSingleName(t *T) {
 	assertEquals(t, Block{
 		Names: []string{"William Wallace"},
-	}, parseBuffer([]byte("William Wallace")))
+	}, parseTestBuffer(t, "William Wallace"))
 }
 
 func TestParseComment(t *T) {
-	assertEquals(t, Block{}, parseBuffer([]byte("// This is a comment.")))
+	assertEquals(t, Block{
+		Comments: []string{"// This is a comment."},
+	}, parseTestBuffer(t, "// This is a comment."))
 }
 
 func TestParseCommentsAndNames(t *T) {
+	// A comment at the end of a line belongs to the name on that line.
+	assertEquals(t, Block{
+		Children: []TaggedBlock{
+			TaggedBlock{
+				Inline: true,
+				Comment: "// This is a comment",
+				Block: Block{Names: []string{"William"}},
+			},
+			TaggedBlock{
+				Inline: true,
+				Block: Block{Names: []string{"Wallace"}},
+			},
+		},
+	}, parseTestBuffer(t, "William // This is a comment\n Wallace"))
+
+	assertEquals(t, Block{
+		Names: []string{"William"},
+		Children: []TaggedBlock{
+			TaggedBlock{
+				Inline: true,
+				Doc: []string{"// This is a comment"},
+				Block: Block{Names: []string{"Wallace"}},
+			},
+		},
+	}, parseTestBuffer(t, "William\n// This is a comment\n Wallace"))
+}
+
+func TestParseBlockComments(t *T) {
+	assertEquals(t, Block{
+		Children: []TaggedBlock{
+			TaggedBlock{
+				Inline: true,
+				Comment: "/* One line. */",
+				Block: Block{Names: []string{"William Wallace"}},
+			},
+		},
+		Comments: []string{"/* Two\n   lines. */"},
+	}, parseTestBuffer(t, "William Wallace /* One line. */\n/* Two\n   lines. */"))
+}
+
+func TestParseCommentsAttachedToBlocks(t *T) {
+	assertEquals(t, Block{
+		Children: []TaggedBlock{
+			TaggedBlock{
+				Tags: []string{"Boulder"},
+				Doc: []string{"// The Free Zone.", "/* http://example.com */"},
+				Block: Block{
+					Names: []string{"Stuart Redman"},
+					Comments: []string{"// The end."},
+				},
+			},
+			TaggedBlock{
+				Tags: []string{"Dog"},
+				Inline: true,
+				Doc: []string{"// A dog."},
+				Block: Block{Names: []string{"Kojak"}},
+			},
+			TaggedBlock{
+				Inline: true,
+				Block: Block{Names: []string{"Abagail Freemantle"}},
+			},
+		},
+	}, parseTestBuffer(t, `
+		// The Free Zone.
+		/* http://example.com */
+		Boulder {
+			Stuart Redman
+			// The end.
+		}
+		// A dog.
+		Kojak: Dog
+		Abagail Freemantle`))
+}
+
+func TestParseTrailingComment(t *T) {
+	assertEquals(t, Block{
+		Names: []string{"William Wallace"},
+		Comments: []string{"// No newline after this."},
+	}, parseTestBuffer(t, "William Wallace\n// No newline after this."))
+
+	assertEquals(t, Block{
+		Children: []TaggedBlock{
+			TaggedBlock{
+				Tags: []string{"Tag"},
+				Comment: "// No newline after this.",
+				Block: Block{Names: []string{"John Smith"}},
+			},
+		},
+	}, parseTestBuffer(t, "Tag {\n\tJohn Smith\n} // No newline after this."))
+}
+
+func TestParseCRLF(t *T) {
 	assertEquals(t, Block{
-		Names: []string{"William", "Wallace"},
-	}, parseBuffer([]byte("William // This is a comment\n Wallace")))
+		Names: []string{"William Wallace"},
+		Children: []TaggedBlock{
+			TaggedBlock{
+				Tags: []string{"Tag1", "Tag2"},
+				Doc: []string{"// A comment.", "/* A block\ncomment. */"},
+				Block: Block{
+					Names: []string{"John Smith", "Jane Doe"},
+				},
+			},
+		},
+	}, parseTestBuffer(t, "William Wallace\r\n// A comment.\r\n/* A block\r\ncomment. */\r\n"+
+		"Tag1, Tag2 {\r\n\tJohn Smith\r\n\tJane Doe\r\n}\r\n"))
+}
+
+func TestParseCRLFErrorPositions(t *T) {
+	_, errs := parseBuffer([]byte("John Smith\r\n#\r\n"))
+	assertEquals(t, []ParseError{
+		ParseError{Line: 2, Column: 1, Text: "#"},
+	}, errs)
+}
+
+func TestParseTagDeclarations(t *T) {
+	assertEquals(t, Block{
+		Children: []TaggedBlock{
+			TaggedBlock{
+				Declaration: TagDeclaration{
+					Kind: "tag",
+					Tag: "Nevada",
+					Tags: []string{"Las Vegas", "Reno"},
+				},
+			},
+			TaggedBlock{
+				Doc: []string{"// Abbreviations."},
+				Declaration: TagDeclaration{
+					Kind: "alias",
+					Tag: "Male",
+					Tags: []string{"M", "Man"},
+				},
+			},
+		},
+	}, parseTestBuffer(t, "tag Nevada > Las Vegas, Reno\n// Abbreviations.\nalias M, Man = Male"))
+}
+
+func TestParseAttributes(t *T) {
+	block := parseTestBuffer(t, `
+		era = 1950s, Europe {
+			Kojak: region=Boulder
+			era=1960s {
+				Stuart Redman
+			}
+		}`)
+
+	assertEquals(t, Block{
+		Children: []TaggedBlock{
+			TaggedBlock{
+				Tags: []string{"era=1950s", "Europe"},
+				Block: Block{
+					Children: []TaggedBlock{
+						TaggedBlock{
+							Tags: []string{"region=Boulder"},
+							Inline: true,
+							Block: Block{Names: []string{"Kojak"}},
+						},
+						TaggedBlock{
+							Tags: []string{"era=1960s"},
+							Block: Block{Names: []string{"Stuart Redman"}},
+						},
+					},
+				},
+			},
+		},
+	}, block)
+
+	// Inner blocks override the values of outer blocks.
+	assertEquals(t, []string{
+		"{Kojak first [Europe] map[era:1950s region:Boulder] 1 false }",
+		"{Kojak last [Europe] map[era:1950s region:Boulder] 1 false }",
+		"{Redman last [Europe] map[era:1960s] 1 false }",
+		"{Stuart first [Europe] map[era:1960s] 1 false }",
+		"{Stuart given [Europe] map[era:1960s] 1 false }",
+	}, blockEntries(block))
+}
+
+func TestParseAttributeKeysIgnoreCase(t *T) {
+	// "era" is the same key as "Era", so the inner block still overrides it.
+	block := parseTestBuffer(t, "Era=1950s { era=1960s { Kojak } }")
+	assertEquals(t, []string{
+		"{Kojak first [] map[era:1960s] 1 false }",
+		"{Kojak last [] map[era:1960s] 1 false }",
+	}, blockEntries(block))
 }
 
 func TestParseSingleTaggedBlock(t *T) {
@@ -27,7 +219,7 @@ func TestParseSingleTaggedBlock(t *T) {
 				Tags: []string{"Tag1"},
 			},
 		},
-	}, parseBuffer([]byte("Tag1 {}")))
+	}, parseTestBuffer(t, "Tag1 {}"))
 }
 
 func TestParseMultiTaggedBlock(t *T) {
@@ -37,7 +229,7 @@ func TestParseMultiTaggedBlock(t *T) {
 				Tags: []string{"Tag1", "Tag2", "Tag3"},
 			},
 		},
-	}, parseBuffer([]byte("Tag1, Tag2, Tag3 {}")))
+	}, parseTestBuffer(t, "Tag1, Tag2, Tag3 {}"))
 }
 
 func TestParseTaggedName(t *T) {
@@ -45,22 +237,267 @@ func TestParseTaggedName(t *T) {
 		Children: []TaggedBlock{
 			TaggedBlock{
 				Tags: []string{"Braveheart", "Movie"},
+				Inline: true,
 				Block: Block{
 					Names: []string{"William Wallace"},
 				},
 			},
 		},
-	}, parseBuffer([]byte("William Wallace:Braveheart,Movie")))
+	}, parseTestBuffer(t, "William Wallace:Braveheart,Movie"))
 }
 
 func TestParseNickName(t *T) {
 	assertEquals(t, Block{
 		Names: []string{"James \"Jimmy\" Douglas"},
-	}, parseBuffer([]byte("James \"Jimmy\" Douglas")))
+	}, parseTestBuffer(t, "James \"Jimmy\" Douglas"))
 }
 
 func TestParseHyphenatedeName(t *T) {
 	assertEquals(t, Block{
 		Names: []string{"James Clarence-Jones"},
-	}, parseBuffer([]byte("James Clarence-Jones")))
+	}, parseTestBuffer(t, "James Clarence-Jones"))
+}
+
+func TestSplitName(t *T) {
+	assertEquals(t, []Entry{
+		Entry{Name: "Peter", Type: "first"},
+		Entry{Name: "Peter", Type: "given"},
+		Entry{Name: "Goldsmith", Type: "last"},
+		Entry{Name: "Redman", Type: "last"},
+	}, fullNameToComponents("Peter Goldsmith-Redman"))
+}
+
+func TestSplitNickName(t *T) {
+	assertEquals(t, []Entry{
+		Entry{Name: "William", Type: "first"},
+		Entry{Name: "William", Type: "given"},
+		Entry{Name: "Billy", Type: "nick"},
+		Entry{Name: "Starkey", Type: "last"},
+	}, fullNameToComponents("William \"Billy\" Starkey"))
+}
+
+func TestSplitInitials(t *T) {
+	assertEquals(t, []Entry{
+		Entry{Name: "Charles", Type: "first"},
+		Entry{Name: "Charles", Type: "given"},
+		Entry{Name: "D.", Type: "initial"},
+		Entry{Name: "Campion", Type: "last"},
+	}, fullNameToComponents("Charles D. Campion"))
+
+	assertEquals(t, []Entry{
+		Entry{Name: "J.R.R.", Type: "initial"},
+		Entry{Name: "Tolkein", Type: "last"},
+	}, fullNameToComponents("J.R.R. Tolkein"))
+
+	assertEquals(t, []Entry{
+		Entry{Name: "J.", Type: "initial"},
+		Entry{Name: "Edgar", Type: "first"},
+		Entry{Name: "Edgar", Type: "given"},
+		Entry{Name: "Hoover", Type: "last"},
+	}, fullNameToComponents("J. Edgar Hoover"))
+
+	assertEquals(t, []Entry{
+		Entry{Name: "George", Type: "first"},
+		Entry{Name: "George", Type: "given"},
+		Entry{Name: "R.", Type: "initial"},
+		Entry{Name: "R.", Type: "initial"},
+		Entry{Name: "Martin", Type: "last"},
+	}, fullNameToComponents("George R. R. Martin"))
+}
+
+func TestParseErrors(t *T) {
+	_, errs := parseBuffer([]byte("Spain {\n\tJosé #1 García %\n}\n}\nJohn Smith"))
+	assertEquals(t, []ParseError{
+		ParseError{Line: 2, Column: 7, Text: "#"},
+		ParseError{Line: 2, Column: 17, Text: "%"},
+		ParseError{Line: 4, Column: 1, Text: "}"},
+	}, errs)
+}
+
+func TestParseRecoversFromErrors(t *T) {
+	// Everything around the errors is still parsed.
+	block, _ := parseBuffer([]byte("A {\n\tB\n\t%\n}\n}\nC"))
+	assertEquals(t, []string{"C"}, block.Names)
+	assertEquals(t, 1, len(block.Children))
+	assertEquals(t, []string{"B"}, block.Children[0].Names)
+}
+
+func TestParseFileErrors(t *T) {
+	_, err := parseNameFiles([]string{"test.names", "testdata/errors.names"})
+	assertEquals(t, Errors{
+		ParseError{Filename: "testdata/errors.names", Line: 3, Column: 2, Text: "#"},
+		ParseError{Filename: "testdata/errors.names", Line: 6, Column: 1, Text: "}"},
+	}, err)
+}
+
+func TestParseMissingFile(t *T) {
+	entries, err := parseNameFile("testdata/missing.names")
+	if !os.IsNotExist(err) {
+		t.Errorf("Expected a file not found error, got %v", err)
+	}
+	assertEquals(t, (<-chan Entry)(nil), entries)
+}
+
+func TestParseFilesWithMissingFile(t *T) {
+	entries, err := parseNameFiles([]string{
+		"testdata/missing.names",
+		"test.names",
+		"testdata/errors.names",
+	})
+
+	errs, ok := err.(Errors)
+	if !ok || len(errs) != 3 {
+		t.Fatalf("Expected 3 errors, got %v", err)
+	}
+	if !os.IsNotExist(errs[0]) {
+		t.Errorf("Expected a file not found error, got %v", errs[0])
+	}
+
+	// Names from the files that could be read are still returned.
+	var names []string
+	for entry := range(entries) {
+		if entry.Type == "last" {
+			names = append(names, entry.Name)
+		}
+	}
+	assertEquals(t, []string{"Smith", "Doe", "Tolkein", "Arnold", "Douglas",
+		"Martin", "Goldsmith", "Redman", "Wallace", "Smith", "Fan", "Doe"}, names)
+}
+
+func TestParseErrorMessage(t *T) {
+	err := ParseError{Filename: "test.names", Line: 3, Column: 14, Text: "}"}
+	assertEquals(t, "test.names:3:14: unexpected '}'", err.Error())
+}
+
+func TestParseUnicodeNames(t *T) {
+	assertEquals(t, Block{
+		Names: []string{
+			"José García",
+			"Seán Ó Briain",
+			"Łukasz Żuławski",
+			"山田　太郎",
+			"محمد عبد الله",
+			"अर्जुन शर्मा",
+			"Dara O’Briain",
+		},
+	}, parseTestBuffer(t, `
+		José García
+		Seán Ó Briain
+		Łukasz Żuławski
+		山田　太郎
+		محمد عبد الله
+		अर्जुन शर्मा
+		Dara O’Briain
+	`))
+}
+
+func TestParseUnicodeTags(t *T) {
+	assertEquals(t, Block{
+		Children: []TaggedBlock{
+			TaggedBlock{
+				Tags: []string{"España", "Éire"},
+				Block: Block{
+					Children: []TaggedBlock{
+						TaggedBlock{
+							Tags: []string{"日本"},
+							Inline: true,
+							Block: Block{
+								Names: []string{"山田"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}, parseTestBuffer(t, "España, Éire {\n\t山田: 日本\n}"))
+}
+
+func TestParseApostropheTags(t *T) {
+	assertEquals(t, Block{
+		Children: []TaggedBlock{
+			TaggedBlock{
+				Tags: []string{"O'Brien Family", "D’Arcy"},
+				Block: Block{
+					Names: []string{"Liam O'Brien"},
+				},
+			},
+		},
+	}, parseTestBuffer(t, "O'Brien Family, D’Arcy {\n\tLiam O'Brien\n}"))
+}
+
+func TestSplitUnicodeName(t *T) {
+	assertEquals(t, []Entry{
+		Entry{Name: "山田", Type: "first"},
+		Entry{Name: "山田", Type: "given"},
+		Entry{Name: "太郎", Type: "last"},
+	}, fullNameToComponents("山田　太郎"))
+
+	assertEquals(t, []Entry{
+		Entry{Name: "Łukasz", Type: "first"},
+		Entry{Name: "Łukasz", Type: "given"},
+		Entry{Name: "Ż.", Type: "initial"},
+		Entry{Name: "Żuławski", Type: "last"},
+	}, fullNameToComponents("Łukasz Ż. Żuławski"))
+}
+
+func TestParseWeightedName(t *T) {
+	assertEquals(t, Block{
+		Children: []TaggedBlock{
+			TaggedBlock{
+				Weight: 50,
+				Inline: true,
+				Block: Block{
+					Names: []string{"John Smith"},
+				},
+			},
+			TaggedBlock{
+				Tags: []string{"Rare"},
+				Weight: 0.5,
+				Inline: true,
+				Block: Block{
+					Names: []string{"Abagail"},
+				},
+			},
+		},
+	}, parseTestBuffer(t, "John Smith *50\nAbagail * 0.5: Rare"))
+}
+
+func TestParseWeightedBlock(t *T) {
+	assertEquals(t, Block{
+		Children: []TaggedBlock{
+			TaggedBlock{
+				Tags: []string{"Boulder", "Male"},
+				Weight: 10,
+				Block: Block{
+					Names: []string{"Stuart Redman"},
+				},
+			},
+		},
+	}, parseTestBuffer(t, "Boulder, Male *10 {\n\tStuart Redman\n}"))
+}
+
+func TestParseZeroWeight(t *T) {
+	_, errs := parseBuffer([]byte("John Smith *0"))
+	assertEquals(t, []ParseError{
+		ParseError{Line: 1, Column: 12, Text: "*"},
+	}, errs)
+}
+
+func TestNestedWeights(t *T) {
+	entries, err := parseNameFile("testdata/weights.names")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	weights := make(map[string]float64)
+	for entry := range(entries) {
+		weights[entry.Name] = entry.Weight
+	}
+	assertEquals(t, map[string]float64{
+		"John": 50,
+		"Jane": 20,
+		"Mary": 10,
+		"Abagail": 5,
+		"Ebenezer": 0.5,
+	}, weights)
 }
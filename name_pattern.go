@@ -0,0 +1,163 @@
+package names
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// A full name template, mixing literal text with slots for name components:
+//
+//	Dr. {Male:first} [{:given}] {Boulder:last}
+//	{:first} ["{:nick}"] {:last}
+//	{:last}-{:last}
+//
+// Each slot ("{...}") contains a template for a single component. Anything in
+// square brackets (slots and text) is optional, and can be given a
+// probability like optional templates ("[, Jr.]?0.1"). Backslashes escape
+// the next character ("\{").
+type Pattern []PatternPart
+
+// A piece of a pattern: literal text, a slot, or an optional group.
+type PatternPart struct {
+	Text string
+
+	// The template for a slot, if this is a slot.
+	Template Matcher
+
+	// The contents of an optional group, if this is one, and the chance of
+	// including it.
+	Optional Pattern
+	Probability float64
+}
+
+func (p Pattern) String() string {
+	var buf bytes.Buffer
+	for _, part := range(p) {
+		switch {
+		case part.Template != nil:
+			fmt.Fprintf(&buf, "{%v}", part.Template)
+		case part.Optional != nil:
+			fmt.Fprintf(&buf, "[%v]", part.Optional)
+			if part.Probability != DefaultProbability {
+				fmt.Fprintf(&buf, "?%g", part.Probability)
+			}
+		default:
+			buf.WriteString(part.Text)
+		}
+	}
+	return buf.String()
+}
+
+// Returns the template of every slot in the pattern, including optional
+// ones.
+func (p Pattern) Templates() []Matcher {
+	var templates []Matcher
+	for _, part := range(p) {
+		if part.Template != nil {
+			templates = append(templates, part.Template)
+		}
+		templates = append(templates, part.Optional.Templates()...)
+	}
+	return templates
+}
+
+// Parses a full name pattern (see Pattern). Syntax errors, including those in
+// the slots' templates, are returned as a TemplateError for the whole pattern.
+func ParsePattern(pattern string) (Pattern, error) {
+	parts, rest, err := parsePatternParts(pattern, 0)
+	if err != nil {
+		return nil, err
+	}
+	if rest != len(pattern) {
+		return nil, patternError(pattern, rest, "unexpected ']'")
+	}
+	return parts, nil
+}
+
+func patternError(pattern string, i int, message string) TemplateError {
+	return TemplateError{
+		Template: pattern,
+		Column: utf8.RuneCountInString(pattern[:i]) + 1,
+		Message: message,
+	}
+}
+
+var patternProbability = regexp.MustCompile(`^\?(0?\.[0-9]+|0|1(\.0*)?)`)
+
+// Parses the parts of a pattern, starting at an offset, until the end of the
+// pattern or a closing bracket. Returns the offset it stopped at.
+func parsePatternParts(pattern string, i int) (Pattern, int, error) {
+	var parts Pattern
+	var text bytes.Buffer
+
+	endText := func() {
+		if text.Len() > 0 {
+			parts = append(parts, PatternPart{Text: text.String()})
+			text.Reset()
+		}
+	}
+
+	for i < len(pattern) {
+		switch pattern[i] {
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+			}
+			text.WriteByte(pattern[i])
+			i++
+
+		case '{':
+			end := strings.IndexByte(pattern[i:], '}')
+			if end < 0 {
+				return nil, i, patternError(pattern, i, "'{' is never closed")
+			}
+			template, err := parseNameTemplate(pattern[i+1 : i+end])
+			if e, ok := err.(TemplateError); ok {
+				// Point at the error in the pattern, rather than in the slot.
+				e.Column += utf8.RuneCountInString(pattern[:i+1])
+				e.Template = pattern
+				return nil, i, e
+			}
+			endText()
+			parts = append(parts, PatternPart{Template: template})
+			i += end + 1
+
+		case '[':
+			optional, end, err := parsePatternParts(pattern, i+1)
+			if err != nil {
+				return nil, end, err
+			}
+			if end == len(pattern) {
+				return nil, i, patternError(pattern, i, "'[' is never closed")
+			}
+
+			part := PatternPart{Optional: optional, Probability: DefaultProbability}
+			i = end + 1
+			if m := patternProbability.FindStringSubmatch(pattern[i:]); m != nil {
+				part.Probability, _ = strconv.ParseFloat(m[1], 64)
+				i += len(m[0])
+			}
+
+			endText()
+			if part.Optional == nil {
+				part.Optional = Pattern{}
+			}
+			parts = append(parts, part)
+
+		case ']':
+			endText()
+			return parts, i, nil
+
+		default:
+			text.WriteByte(pattern[i])
+			i++
+		}
+	}
+
+	endText()
+	return parts, i, nil
+}
@@ -0,0 +1,140 @@
+package names
+
+import (
+	"strings"
+	. "testing"
+)
+
+func mustParsePattern(t *T, pattern string) Pattern {
+	p, err := ParsePattern(pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestParsePattern(t *T) {
+	assertEquals(t, Pattern{
+		PatternPart{Text: "Dr. "},
+		PatternPart{Template: mustParseTemplate(t, "Male:first")},
+		PatternPart{Text: " "},
+		PatternPart{
+			Optional: Pattern{PatternPart{Template: mustParseTemplate(t, ":given")}},
+			Probability: DefaultProbability,
+		},
+		PatternPart{Text: " "},
+		PatternPart{Template: mustParseTemplate(t, "Boulder:last")},
+		PatternPart{
+			Optional: Pattern{PatternPart{Text: ", Jr."}},
+			Probability: 0.1,
+		},
+	}, mustParsePattern(t, "Dr. {Male:first} [{:given}] {Boulder:last}[, Jr.]?0.1"))
+
+	assertEquals(t, Pattern{
+		PatternPart{Template: mustParseTemplate(t, ":first")},
+		PatternPart{Text: ` "`},
+		PatternPart{Template: mustParseTemplate(t, ":nick")},
+		PatternPart{Text: `" {[x]} `},
+		PatternPart{Template: mustParseTemplate(t, "[:last]?0.2")},
+	}, mustParsePattern(t, `{:first} "{:nick}" \{\[x\]} {[:last]?0.2}`))
+}
+
+func TestPatternString(t *T) {
+	assertEquals(t,
+		"Dr. {(Or [(And [Male:first])])} [{(Or [(And [:given])])}]?0.1-{(Or [(And [:last])])}",
+		mustParsePattern(t, "Dr. {Male:first} [{:given}]?0.1-{:last}").String())
+}
+
+func TestParseInvalidPatterns(t *T) {
+	for pattern, expected := range(map[string]TemplateError{
+		"{Male:first": TemplateError{Column: 1, Message: "'{' is never closed"},
+		"{:first} [{:given}": TemplateError{Column: 10, Message: "'[' is never closed"},
+		"{:first} {:given}]": TemplateError{Column: 18, Message: "unexpected ']'"},
+		"{:first} {%}": TemplateError{Column: 11, Message: "expected tag or filter"},
+		"{:first} {Male +}": TemplateError{Column: 17, Message: "expected tag after '+'"},
+		"[[{:first}]": TemplateError{Column: 1, Message: "'[' is never closed"},
+	}) {
+		_, err := ParsePattern(pattern)
+		expected.Template = pattern
+		assertEquals(t, expected, err)
+	}
+}
+
+func TestGeneratePattern(t *T) {
+	g := testGenerator(t)
+	pattern := mustParsePattern(t, `Dr. {Male:first} ["{:nick}"] {Boulder:last}-{Las Vegas:last}[, Jr.]`)
+
+	for i := 0; i < 20; i++ {
+		name, err := g.GeneratePattern(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Skipped optional parts don't leave extra spaces behind.
+		if strings.Contains(name, "  ") || strings.HasSuffix(name, " ") {
+			t.Errorf("Extra spaces in %q", name)
+		}
+
+		parts := strings.Split(strings.TrimSuffix(name, ", Jr."), " ")
+		if len(parts) < 3 || len(parts) > 4 || parts[0] != "Dr." {
+			t.Fatalf("Expected a title, a first and last name, and maybe a nickname, got %q", name)
+		}
+		if len(parts) == 4 && !strings.HasPrefix(parts[2], `"`) {
+			t.Errorf("Expected a quoted nickname in %q", name)
+		}
+
+		last := strings.Split(parts[len(parts)-1], "-")
+		if len(last) != 2 || !g.Dictionary[last[0]].HasTag("Boulder") ||
+			!g.Dictionary[last[1]].HasTag("Las Vegas") {
+			t.Errorf("Expected a hyphenated Boulder and Las Vegas last name, got %q", name)
+		}
+	}
+}
+
+func TestGeneratePatternSeeded(t *T) {
+	g := NewSeededGenerator(42)
+	if err := g.LoadFiles("Steven King.names"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A pattern of slots separated by spaces generates the same names as the
+	// equivalent templates.
+	templates := []Matcher{mustParseTemplate(t, ":first"), mustParseTemplate(t, ":last")}
+	pattern := mustParsePattern(t, "{:first} {:last}")
+
+	expected := make([]string, 5)
+	for i := range(expected) {
+		expected[i], _ = g.Generate(templates...)
+	}
+
+	g.Rand.Seed(42)
+	for _, name := range(expected) {
+		actual, err := g.GeneratePattern(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertEquals(t, name, actual)
+	}
+}
+
+func TestCompilePattern(t *T) {
+	g := testGenerator(t)
+	c, err := g.CompilePattern(mustParsePattern(t, "{Male:first} [{Dog:first}]?0.5 {Las Vegas:last}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Slots after a skipped optional part still use their own matches.
+	for i := 0; i < 20; i++ {
+		parts := strings.Split(c.Generate(), " ")
+		if last := parts[len(parts)-1]; !g.Dictionary[last].HasTag("Las Vegas") {
+			t.Errorf("Expected a Las Vegas last name, got %q", last)
+		}
+	}
+}
+
+func TestGeneratePatternNoMatch(t *T) {
+	g := testGenerator(t)
+	_, err := g.GeneratePattern(mustParsePattern(t, "{:first} [{Dog:given}] {:last}"))
+	assertEquals(t, Errors{NoMatchError{mustParseTemplate(t, "Dog:given")}}, err)
+}
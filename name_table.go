@@ -0,0 +1,200 @@
+package names
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Describes which columns of a name table (by their header) are used for what.
+type ColumnMapping struct {
+	// The column containing names.
+	Name string
+
+	// Columns whose values are used as tags (e.g. a "gender" column with
+	// values like "F" and "M").
+	Tags []string
+
+	// Columns whose values are used as key/value tags, with the column header
+	// as the key (e.g. a "year" column gives "year=1880").
+	Attributes []string
+
+	// An optional column with each name's weight, like a count or frequency.
+	Weight string
+
+	// The type of name part ("first", "last", etc.) that every name in the
+	// table is. If not set, names are split up like full names in name files.
+	Type string
+}
+
+// Parses a column mapping like "name=Name,tag=Gender,attr=Year,weight=Count".
+// The keys are "name", "tag" and "attr" (which may be repeated), "weight" and
+// "type".
+func ParseColumnMapping(spec string) (ColumnMapping, error) {
+	var m ColumnMapping
+	for _, field := range(strings.Split(spec, ",")) {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return m, fmt.Errorf("Not a valid column mapping: '%s'", field)
+		}
+
+		key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		switch key {
+		case "name":
+			m.Name = value
+		case "tag":
+			m.Tags = append(m.Tags, value)
+		case "attr":
+			m.Attributes = append(m.Attributes, value)
+		case "weight":
+			m.Weight = value
+		case "type":
+			m.Type = value
+		default:
+			return m, fmt.Errorf("Unknown column mapping key: '%s'", key)
+		}
+	}
+
+	if m.Name == "" {
+		return m, fmt.Errorf("No name column in column mapping: '%s'", spec)
+	}
+	return m, nil
+}
+
+// A CSV or TSV (if the extension is ".tsv") file of names, like a census or
+// name frequency table. The first row must be a header.
+type NameTable struct {
+	Filename string
+	Columns ColumnMapping
+}
+
+func (t NameTable) Entries() (<-chan Entry, error) {
+	file, err := os.Open(t.Filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	if strings.ToLower(filepath.Ext(t.Filename)) == ".tsv" {
+		reader.Comma = '\t'
+		reader.LazyQuotes = true
+	}
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%s: missing header row", t.Filename)
+	}
+
+	// Find the index of each mapped column.
+	columns := make(map[string]int)
+	for i, header := range(rows[0]) {
+		columns[strings.TrimSpace(header)] = i
+	}
+
+	var errs Errors
+	column := func(header string) int {
+		i, ok := columns[header]
+		if !ok {
+			errs = append(errs,
+				fmt.Errorf("%s: no column named '%s'", t.Filename, header))
+		}
+		return i
+	}
+
+	nameCol := column(t.Columns.Name)
+	tagCols := make([]int, len(t.Columns.Tags))
+	for i, header := range(t.Columns.Tags) {
+		tagCols[i] = column(header)
+	}
+	attributeCols := make([]int, len(t.Columns.Attributes))
+	for i, header := range(t.Columns.Attributes) {
+		attributeCols[i] = column(header)
+	}
+	weightCol := -1
+	if t.Columns.Weight != "" {
+		weightCol = column(t.Columns.Weight)
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	var entries []Entry
+	for i, row := range(rows[1:]) {
+		line := i + 2
+
+		name := strings.TrimSpace(row[nameCol])
+		if name == "" {
+			continue
+		}
+
+		var tags []string
+		for _, col := range(tagCols) {
+			if tag := strings.TrimSpace(row[col]); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+
+		var attributes map[string]string
+		for i, col := range(attributeCols) {
+			if value := strings.TrimSpace(row[col]); value != "" {
+				if attributes == nil {
+					attributes = make(map[string]string)
+				}
+				attributes[t.Columns.Attributes[i]] = value
+			}
+		}
+
+		weight := 1.0
+		if weightCol >= 0 {
+			value := strings.TrimSpace(row[weightCol])
+			weight, err = strconv.ParseFloat(value, 64)
+			if err != nil || weight < 0 {
+				errs = append(errs, fmt.Errorf("%s:%d: invalid weight '%s'",
+					t.Filename, line, value))
+				continue
+			}
+
+			// Names that never occurred (e.g. a count of zero) are skipped.
+			if weight == 0 {
+				continue
+			}
+		}
+
+		var components []Entry
+		if t.Columns.Type != "" {
+			components = []Entry{Entry{Name: name, Type: t.Columns.Type}}
+		} else {
+			components = fullNameToComponents(name)
+		}
+
+		for _, entry := range(components) {
+			entry.Tags = tags
+			entry.Attributes = attributes
+			entry.Weight = weight
+			entry.Frequency = true
+			entries = append(entries, entry)
+		}
+	}
+
+	out := make(chan Entry)
+
+	go func() {
+		defer close(out)
+		for _, entry := range(entries) {
+			out <- entry
+		}
+	}()
+
+	if len(errs) > 0 {
+		return out, errs
+	}
+	return out, nil
+}
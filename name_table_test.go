@@ -0,0 +1,178 @@
+package names
+
+import (
+	. "testing"
+)
+
+// Reads all of the entries from a table, failing the test on any errors.
+func tableEntries(t *T, table NameTable) []Entry {
+	entries, err := table.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var all []Entry
+	for entry := range(entries) {
+		all = append(all, entry)
+	}
+	return all
+}
+
+func TestParseColumnMapping(t *T) {
+	m, err := ParseColumnMapping("name=Name, tag=Gender,tag=Year,attr=Rank,weight=Count,type=first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEquals(t, ColumnMapping{
+		Name: "Name",
+		Tags: []string{"Gender", "Year"},
+		Attributes: []string{"Rank"},
+		Weight: "Count",
+		Type: "first",
+	}, m)
+}
+
+func TestParseInvalidColumnMapping(t *T) {
+	for _, spec := range([]string{"", "tag=Gender", "name", "name=Name,color=Red"}) {
+		if _, err := ParseColumnMapping(spec); err == nil {
+			t.Errorf("Parsing '%s' should have failed.", spec)
+		}
+	}
+}
+
+func TestReadCSV(t *T) {
+	assertEquals(t, []Entry{
+		Entry{Name: "Mary", Type: "first", Tags: []string{"F", "1880"}, Weight: 7065, Frequency: true},
+		Entry{Name: "Anna", Type: "first", Tags: []string{"F", "1880"}, Weight: 2604, Frequency: true},
+		Entry{Name: "John", Type: "first", Tags: []string{"M", "1880"}, Weight: 9655, Frequency: true},
+		Entry{Name: "William", Type: "first", Tags: []string{"M", "1880"}, Weight: 9532, Frequency: true},
+		Entry{Name: "Mary Ann", Type: "first", Tags: []string{"F", "1880"}, Weight: 150, Frequency: true},
+	}, tableEntries(t, NameTable{"testdata/census.csv", ColumnMapping{
+		Name: "name",
+		Tags: []string{"gender", "year"},
+		Weight: "count",
+		Type: "first",
+	}}))
+}
+
+func TestReadTableAttributes(t *T) {
+	year := map[string]string{"year": "1880"}
+	assertEquals(t, []Entry{
+		Entry{Name: "Mary", Type: "first", Tags: []string{"F"}, Attributes: year, Weight: 1, Frequency: true},
+		Entry{Name: "Anna", Type: "first", Tags: []string{"F"}, Attributes: year, Weight: 1, Frequency: true},
+		Entry{Name: "John", Type: "first", Tags: []string{"M"}, Attributes: year, Weight: 1, Frequency: true},
+		Entry{Name: "William", Type: "first", Tags: []string{"M"}, Attributes: year, Weight: 1, Frequency: true},
+		Entry{Name: "Mary", Type: "first", Tags: []string{"M"}, Attributes: year, Weight: 1, Frequency: true},
+		Entry{Name: "Mary Ann", Type: "first", Tags: []string{"F"}, Attributes: year, Weight: 1, Frequency: true},
+	}, tableEntries(t, NameTable{"testdata/census.csv", ColumnMapping{
+		Name: "name",
+		Tags: []string{"gender"},
+		Attributes: []string{"year"},
+		Type: "first",
+	}}))
+}
+
+func TestReadTSVFullNames(t *T) {
+	// Without a type, names are split up like names in name files.
+	assertEquals(t, []Entry{
+		Entry{Name: "O’Brien", Type: "first", Tags: []string{"Ireland"}, Weight: 1, Frequency: true},
+		Entry{Name: "O’Brien", Type: "last", Tags: []string{"Ireland"}, Weight: 1, Frequency: true},
+		Entry{Name: "Murphy", Type: "first", Tags: []string{"Ireland"}, Weight: 1, Frequency: true},
+		Entry{Name: "Murphy", Type: "last", Tags: []string{"Ireland"}, Weight: 1, Frequency: true},
+		Entry{Name: "Kowalski", Type: "first", Tags: []string{"Poland"}, Weight: 1, Frequency: true},
+		Entry{Name: "Kowalski", Type: "last", Tags: []string{"Poland"}, Weight: 1, Frequency: true},
+	}, tableEntries(t, NameTable{"testdata/surnames.tsv", ColumnMapping{
+		Name: "Name",
+		Tags: []string{"Region"},
+	}}))
+}
+
+func TestReadTableMissingColumns(t *T) {
+	_, err := NameTable{"testdata/census.csv", ColumnMapping{
+		Name: "Name",
+		Tags: []string{"gender", "decade"},
+	}}.Entries()
+	assertEquals(t, "testdata/census.csv: no column named 'Name'\n"+
+		"testdata/census.csv: no column named 'decade'", err.Error())
+}
+
+func TestReadTableInvalidWeight(t *T) {
+	entries, err := NameTable{"testdata/census.csv", ColumnMapping{
+		Name: "name",
+		Weight: "gender",
+		Type: "first",
+	}}.Entries()
+	assertEquals(t, "testdata/census.csv:2: invalid weight 'F'\n"+
+		"testdata/census.csv:3: invalid weight 'F'\n"+
+		"testdata/census.csv:4: invalid weight 'M'\n"+
+		"testdata/census.csv:5: invalid weight 'M'\n"+
+		"testdata/census.csv:6: invalid weight 'M'\n"+
+		"testdata/census.csv:7: invalid weight 'F'", err.Error())
+
+	count := 0
+	for _ = range(entries) {
+		count++
+	}
+	assertEquals(t, 0, count)
+}
+
+func TestGenerateFromTable(t *T) {
+	g := NewSeededGenerator(1)
+	err := g.Load(
+		NameTable{"testdata/census.csv", ColumnMapping{
+			Name: "name",
+			Tags: []string{"gender"},
+			Weight: "count",
+			Type: "first",
+		}},
+		NameTable{"testdata/surnames.tsv", ColumnMapping{
+			Name: "Name",
+			Tags: []string{"Region"},
+			Weight: "Count",
+			Type: "last",
+		}},
+		NameFile("test.names"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Templates work the same for tables as for name files.
+	assertEquals(t,
+		[]string{"Anna", "Mary", "Mary Ann"},
+		g.Match(mustParseTemplate(t, "F:first")))
+	assertEquals(t,
+		[]string{"Murphy", "O’Brien"},
+		g.Match(mustParseTemplate(t, "Ireland:last")))
+	assertEquals(t, 7065.0, g.Weight("Mary"))
+
+	name, err := g.Generate(
+		mustParseTemplate(t, "M:first"),
+		mustParseTemplate(t, "Poland:last"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEquals(t, "William Kowalski", name)
+}
+
+func TestTableWeightsAddUp(t *T) {
+	// A name in more than one row (one per year) is as likely as all of its
+	// rows put together, with or without -weighted.
+	g := NewSeededGenerator(1)
+	err := g.Load(NameTable{"testdata/years.csv", ColumnMapping{
+		Name: "name",
+		Tags: []string{"gender"},
+		Attributes: []string{"year"},
+		Weight: "count",
+		Type: "first",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEquals(t, 22132.0, g.Weight("Mary"))
+	assertEquals(t, 18424.0, g.Weight("John"))
+	assertEquals(t, []string{"1880", "1881", "1882"}, g.Dictionary["Mary"].Attributes["year"])
+
+	g.Weighted = true
+	assertEquals(t, 22132.0, g.Weight("Mary"))
+}
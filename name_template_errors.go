@@ -0,0 +1,147 @@
+package names
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	p "github.com/prataprc/goparsec"
+)
+
+// A syntax error in a template (or pattern), at a column (counted in
+// characters, from 1). The error message includes the template, with a
+// caret pointing at the column:
+//
+//	col 7: expected tag after '+'
+//		Foo +
+//		      ^
+type TemplateError struct {
+	Template string
+	Column int
+	Message string
+}
+
+func (e TemplateError) Error() string {
+	return fmt.Sprintf("col %d: %s\n\t%s\n\t%s^", e.Column, e.Message,
+		e.Template, strings.Repeat(" ", e.Column-1))
+}
+
+// The furthest point in a template that the parser expected something it
+// didn't find, and what it expected there (see expect).
+type parseFailure struct {
+	src string
+	offset int
+	expected string
+}
+
+// A scanner that records parse failures, which are shared with all of its
+// clones (the combinators clone scanners to backtrack).
+type failureScanner struct {
+	p.Scanner
+	failure *parseFailure
+}
+
+func newFailureScanner(src string) *failureScanner {
+	return &failureScanner{
+		Scanner: p.NewScanner([]byte(src)),
+		failure: &parseFailure{src: src, offset: -1},
+	}
+}
+
+func (s *failureScanner) Clone() p.Scanner {
+	return &failureScanner{s.Scanner.Clone(), s.failure}
+}
+
+// The scanning methods advance the scanner in place, so they return the
+// failureScanner itself rather than the scanner it wraps.
+
+func (s *failureScanner) Match(pattern string) ([]byte, p.Scanner) {
+	token, _ := s.Scanner.Match(pattern)
+	return token, s
+}
+
+func (s *failureScanner) MatchString(str string) (bool, p.Scanner) {
+	ok, _ := s.Scanner.MatchString(str)
+	return ok, s
+}
+
+func (s *failureScanner) SubmatchAll(pattern string) (map[string][]byte, p.Scanner) {
+	captures, _ := s.Scanner.SubmatchAll(pattern)
+	return captures, s
+}
+
+func (s *failureScanner) SkipWS() ([]byte, p.Scanner) {
+	ws, _ := s.Scanner.SkipWS()
+	return ws, s
+}
+
+func (s *failureScanner) SkipAny(pattern string) ([]byte, p.Scanner) {
+	skipped, _ := s.Scanner.SkipAny(pattern)
+	return skipped, s
+}
+
+// Labels a parser with what it's expected to match there, like "tag after
+// '+'". If it fails, that's what the template was expected to have at the
+// point it started (unless something inside it got further).
+func expect(what string, parser p.Parser) p.Parser {
+	return func(s p.Scanner) (p.ParsecNode, p.Scanner) {
+		n, s2 := parser(s)
+		if n == nil {
+			expected(s, what)
+		}
+		return n, s2
+	}
+}
+
+// Records that something was expected at a scanner's position (after any
+// whitespace), if the parser hasn't already failed further on. Of the
+// failures at the same point, the last one is kept: anything tried before it
+// there was optional, and it's what the parser needed to continue.
+func expected(s p.Scanner, what string) {
+	fs, ok := s.(*failureScanner)
+	if !ok {
+		return
+	}
+	_, ws := s.Clone().SkipWS()
+	if i := ws.GetCursor(); i >= fs.failure.offset {
+		fs.failure.offset, fs.failure.expected = i, what
+	}
+}
+
+// Returns the column of a scanner's position (after any whitespace) in a
+// template, for pointing back at brackets that aren't closed. It's only known
+// when parsing with a failureScanner (otherwise, it's 0).
+func column(s p.Scanner) int {
+	fs, ok := s.(*failureScanner)
+	if !ok {
+		return 0
+	}
+	_, ws := s.Clone().SkipWS()
+	return fs.failure.column(ws.GetCursor())
+}
+
+func (f *parseFailure) column(i int) int {
+	return utf8.RuneCountInString(f.src[:i]) + 1
+}
+
+// Returns the error for a template that couldn't be parsed completely, given
+// whether any of it could be parsed, and where the parser stopped. If the
+// parser got further than that before failing (or didn't parse anything), the
+// error is what it expected there. Otherwise, the template has something that
+// can't come next where the parser stopped.
+func (f *parseFailure) templateError(parsed bool, stopped int) TemplateError {
+	e := TemplateError{Template: f.src}
+	switch {
+	case !parsed || f.offset > stopped:
+		e.Column = f.column(f.offset)
+		e.Message = "expected " + f.expected
+	case stopped >= len(f.src):
+		e.Column = f.column(stopped)
+		e.Message = "unexpected end of template"
+	default:
+		r, _ := utf8.DecodeRuneInString(f.src[stopped:])
+		e.Column = f.column(stopped)
+		e.Message = fmt.Sprintf("unexpected '%c'", r)
+	}
+	return e
+}
@@ -0,0 +1,74 @@
+package names
+
+import (
+	. "testing"
+)
+
+func TestTemplateErrorMessage(t *T) {
+	_, err := parseNameTemplate("Foo + ")
+	assertEquals(t, "col 7: expected tag after '+'\n\tFoo + \n\t      ^", err.Error())
+}
+
+func TestMalformedTemplates(t *T) {
+	for template, expected := range(map[string]TemplateError{
+		// Empty templates.
+		"": TemplateError{Column: 1, Message: "expected tag or filter"},
+		"   ": TemplateError{Column: 4, Message: "expected tag or filter"},
+
+		// Operators without a term after them.
+		"Foo + ": TemplateError{Column: 7, Message: "expected tag after '+'"},
+		"Foo -": TemplateError{Column: 6, Message: "expected tag after '-'"},
+		"Foo |": TemplateError{Column: 6, Message: "expected tag after '|'"},
+		"Foo | | Bar": TemplateError{Column: 7, Message: "expected tag after '|'"},
+		"+": TemplateError{Column: 2, Message: "expected tag after '+'"},
+		"Foo + - Bar": TemplateError{Column: 7, Message: "expected tag after '+'"},
+
+		// Filters.
+		"Foo:": TemplateError{Column: 5, Message: "expected filter after ':'"},
+		":": TemplateError{Column: 2, Message: "expected filter after ':'"},
+		"Foo:First": TemplateError{Column: 5, Message: "expected filter after ':'"},
+		"Foo:first:last": TemplateError{Column: 10, Message: "unexpected ':'"},
+
+		// Groups.
+		"Foo )": TemplateError{Column: 5, Message: "unexpected ')'"},
+		"(Foo": TemplateError{Column: 5, Message: "expected ')' to close '(' at col 1"},
+		"Male + (Boulder | (Las Vegas)": TemplateError{Column: 30, Message: "expected ')' to close '(' at col 8"},
+		"()": TemplateError{Column: 2, Message: "expected tag after '('"},
+		"(Foo):": TemplateError{Column: 7, Message: "expected filter after ':'"},
+
+		// Optional templates.
+		"[Foo": TemplateError{Column: 5, Message: "expected ']' to close '[' at col 1"},
+		"[]": TemplateError{Column: 2, Message: "expected tag after '['"},
+		"[Foo]?": TemplateError{Column: 7, Message: "expected probability from 0 to 1 after '?'"},
+		"[Foo]?2": TemplateError{Column: 7, Message: "expected probability from 0 to 1 after '?'"},
+		"[:given]?1.5": TemplateError{Column: 10, Message: "expected probability from 0 to 1 after '?'"},
+		"[Foo] + Bar": TemplateError{Column: 7, Message: "unexpected '+'"},
+		"Foo [Bar]": TemplateError{Column: 5, Message: "unexpected '['"},
+
+		// Attributes.
+		"era=": TemplateError{Column: 5, Message: "expected value after 'era='"},
+		"era != ": TemplateError{Column: 8, Message: "expected value after 'era!='"},
+		"year >= 19th": TemplateError{Column: 11, Message: "unexpected 't'"},
+		"year >= ": TemplateError{Column: 9, Message: "expected number after 'year>='"},
+		"rank<": TemplateError{Column: 6, Message: "expected number after 'rank<'"},
+		"era in ()": TemplateError{Column: 9, Message: "expected value in list of values for 'era'"},
+		"era in (1940s, 1950s": TemplateError{Column: 21, Message: "expected ')' to close list of values for 'era'"},
+		"year in 1900..": TemplateError{Column: 15, Message: "expected number after 'year in 1900..'"},
+		"year in 1950..1900": TemplateError{Column: 15, Message: "expected number of at least 1950 after 'year in 1950..'"},
+		"year in 1900 +": TemplateError{Column: 15, Message: "expected tag after '+'"},
+
+		// Anything else.
+		"% J#QOQ# ^#Q#": TemplateError{Column: 1, Message: "expected tag or filter"},
+		"Foo # Bar": TemplateError{Column: 5, Message: "unexpected '#'"},
+		"Éire + 日本 %": TemplateError{Column: 11, Message: "unexpected '%'"},
+	}) {
+		result, err := parseNameTemplate(template)
+		if result != nil {
+			t.Errorf("Parsing %q should have failed, got %v", template, result)
+		}
+		expected.Template = template
+		if !assertEquals(t, expected, err) {
+			t.Logf("Template: %q", template)
+		}
+	}
+}
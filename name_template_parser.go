@@ -1,34 +1,67 @@
-package main
+package names
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 
 	p "github.com/prataprc/goparsec"
 )
 
 // Data/AST Definition
 
-// A single 'piece' of a template, like a Tag (possibly negated).
+// A single 'piece' of a template, like a Tag (possibly negated). Matchers are
+// checked against the merged properties of each name in the dictionary.
 type Matcher interface {
-	Matches(Entry) bool
+	Matches(Properties) bool
 }
 
+// An optional name component ("[template]"), which is only included in a
+// generated name some of the time.
 type Maybe struct {
 	Matcher
+
+	// The chance of the component being included, from 0 to 1.
+	Probability float64
 }
 
+// The probability of an optional component being included if none is given.
+const DefaultProbability = 0.5
+
 func (m Maybe) String() string {
-	return fmt.Sprintf("[%s]", m.Matcher)
+	if m.Probability == DefaultProbability {
+		return fmt.Sprintf("[%s]", m.Matcher)
+	}
+	return fmt.Sprintf("[%s]?%g", m.Matcher, m.Probability)
 }
 
-// A single tag to match.
+// A single tag to match. Entries inherit the tags of every block that
+// encloses them, so a tag matches anything nested (at any depth) within a
+// block with that tag.
 type Tag string
 
+func (t Tag) Matches(p Properties) bool {
+	return p.HasTag(t)
+}
+
 // A standalone filter.
 type Filter string
 
-func (f Filter) Matches(e Entry) bool {
-	return e.Type == string(f)
+func (f Filter) Matches(p Properties) bool {
+	switch f {
+	case "first":
+		return p.First
+	case "given":
+		return p.Given
+	case "last":
+		return p.Last
+	case "nick":
+		return p.Nick
+	case "initial":
+		return p.Initial
+	}
+	return false
 }
 
 func (f Filter) String() string {
@@ -41,16 +74,92 @@ type Filtered struct {
 	Filter
 }
 
+// Both Tag and Filter provide Matches, so the embedded methods are ambiguous
+// and have to be combined explicitly.
+func (f Filtered) Matches(p Properties) bool {
+	return f.Tag.Matches(p) && f.Filter.Matches(p)
+}
+
 func (f Filtered) String() string {
 	return fmt.Sprintf("%s%s", f.Tag, f.Filter)
 }
 
+// A key/value tag to match ("era=1950s"), or any of a set of values for the
+// same key ("era in (1940s, 1950s)").
+type Attribute struct {
+	Key string
+	Values []string
+}
+
+func (a Attribute) Matches(p Properties) bool {
+	for _, value := range(a.Values) {
+		if p.HasAttribute(a.Key, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a Attribute) String() string {
+	if len(a.Values) == 1 {
+		return fmt.Sprintf("%s=%s", a.Key, a.Values[0])
+	}
+	return fmt.Sprintf("%s in (%s)", a.Key, strings.Join(a.Values, ", "))
+}
+
+// Compares a numeric attribute to a number ("year>=1950"). Names without
+// the attribute, or whose values aren't numbers, don't match.
+type Comparison struct {
+	Key string
+
+	// One of ">=", "<=", ">" or "<".
+	Op string
+	Value float64
+}
+
+func (c Comparison) Matches(p Properties) bool {
+	for _, v := range(p.NumericAttribute(c.Key)) {
+		switch {
+		case c.Op == ">=" && v >= c.Value,
+			c.Op == "<=" && v <= c.Value,
+			c.Op == ">" && v > c.Value,
+			c.Op == "<" && v < c.Value:
+			return true
+		}
+	}
+	return false
+}
+
+func (c Comparison) String() string {
+	return fmt.Sprintf("%s%s%g", c.Key, c.Op, c.Value)
+}
+
+// Matches names with a numeric attribute in a range, including both ends
+// ("year in 1900..1950").
+type Range struct {
+	Key string
+	Min, Max float64
+}
+
+func (r Range) Matches(p Properties) bool {
+	for _, v := range(p.NumericAttribute(r.Key)) {
+		if v >= r.Min && v <= r.Max {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Range) String() string {
+	return fmt.Sprintf("%s in %g..%g", r.Key, r.Min, r.Max)
+}
+
 // A conjunction of tags/chunks that must all must match.
 type And []Matcher
 
-func (a And) Matches(e Entry) bool {
+func (a And) Matches(p Properties) bool {
 	for _, matcher := range(a) {
-		if !matcher.Matches(e) {
+		if !matcher.Matches(p) {
 			return false
 		}
 	}
@@ -61,12 +170,14 @@ func (a And) String() string {
 	return fmt.Sprintf("(And %v)", []Matcher(a))
 }
 
-// A disjunction of conjunctions of which at least one must match.
+// A disjunction of conjunctions of which at least one must match. Since
+// parenthesized groups can be terms of a conjunction, these can be nested to
+// any depth.
 type Or []And
 
-func (o Or) Matches(e Entry) bool {
+func (o Or) Matches(p Properties) bool {
 	for _, matcher := range(o) {
-		if matcher.Matches(e) {
+		if matcher.Matches(p) {
 			return true
 		}
 	}
@@ -82,49 +193,243 @@ type Not struct {
 	Matcher
 }
 
+func (n Not) Matches(p Properties) bool {
+	return !n.Matcher.Matches(p)
+}
+
 func (n Not) String() string {
 	return fmt.Sprintf("(Not %s)", n.Matcher)
 }
 
+// Checks a name against a template. Nicknames and initials are never returned
+// unless the template explicitly asks for them with :nick or :initial, but
+// nicknames that were also used as a normal name part are still allowed.
+func matchesName(m Matcher, p Properties) bool {
+	if !p.NotNick && !wantsFilter(m, "nick") {
+		return false
+	}
+	if p.Initial && !wantsFilter(m, "initial") {
+		return false
+	}
+	return m.Matches(p)
+}
+
+// Checks whether a template contains a (non-negated) filter.
+func wantsFilter(m Matcher, f Filter) bool {
+	switch m := m.(type) {
+	case Filter:
+		return m == f
+	case Filtered:
+		return m.Filter == f
+	case Maybe:
+		return wantsFilter(m.Matcher, f)
+	case And:
+		for _, term := range(m) {
+			if wantsFilter(term, f) {
+				return true
+			}
+		}
+	case Or:
+		for _, term := range(m) {
+			if wantsFilter(term, f) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returned when a template compares an attribute numerically, but none of the
+// names have the attribute, or a name has a value for it that isn't a number.
+type AttributeError struct {
+	Key string
+
+	// The name with a value that isn't a number, and the value. Both are empty
+	// if no names have the attribute.
+	Name, Value string
+}
+
+func (e AttributeError) Error() string {
+	if e.Name == "" {
+		return fmt.Sprintf("No names have a value for '%s'", e.Key)
+	}
+	return fmt.Sprintf("The value of '%s' for %s is not a number: '%s'", e.Key, e.Name, e.Value)
+}
+
+// Returns the keys of every attribute a template compares numerically.
+func numericKeys(m Matcher) []string {
+	switch m := m.(type) {
+	case Comparison:
+		return []string{m.Key}
+	case Range:
+		return []string{m.Key}
+	case Maybe:
+		return numericKeys(m.Matcher)
+	case Not:
+		return numericKeys(m.Matcher)
+	case And:
+		var keys []string
+		for _, term := range(m) {
+			keys = append(keys, numericKeys(term)...)
+		}
+		return keys
+	case Or:
+		var keys []string
+		for _, term := range(m) {
+			keys = append(keys, numericKeys(term)...)
+		}
+		return keys
+	}
+	return nil
+}
+
+// Returns the part of a template that selects names other than by comparing
+// attributes numerically, or nil if it doesn't (so it could select any name).
+// Negated terms that compare attributes are left out, since names without a
+// number to compare could match them.
+func withoutNumeric(m Matcher) Matcher {
+	switch m := m.(type) {
+	case Comparison, Range:
+		return nil
+	case Maybe:
+		return withoutNumeric(m.Matcher)
+	case Not:
+		if len(numericKeys(m.Matcher)) > 0 {
+			return nil
+		}
+		return m
+	case And:
+		var terms And
+		for _, term := range(m) {
+			if term = withoutNumeric(term); term != nil {
+				terms = append(terms, term)
+			}
+		}
+		if len(terms) == 0 {
+			return nil
+		}
+		return terms
+	case Or:
+		var terms Or
+		for _, term := range(m) {
+			selected, ok := withoutNumeric(term).(And)
+			if !ok {
+				return nil
+			}
+			terms = append(terms, selected)
+		}
+		return terms
+	}
+	return m
+}
+
+// Checks that every attribute a template compares numerically is given for
+// at least one name, and is a number for every name the rest of the template
+// selects (other names can have any value, since they won't match anyway).
+func checkNumericAttributes(m Matcher, d NameDictionary, h *TagHierarchy) error {
+	selected := withoutNumeric(m)
+	for _, key := range(numericKeys(m)) {
+		// Names are checked in order, so that the same error is always
+		// reported.
+		var names []string
+		for name, props := range(d) {
+			if len(props.Attributes[strings.ToLower(key)]) > 0 {
+				names = append(names, name)
+			}
+		}
+		if len(names) == 0 {
+			return AttributeError{Key: key}
+		}
+
+		sort.Strings(names)
+		for _, name := range(names) {
+			props := d[name]
+			if selected != nil {
+				props.Tags = h.Expand(props.Tags)
+				if !matchesName(selected, props) {
+					continue
+				}
+			}
+			for _, value := range(props.Attributes[strings.ToLower(key)]) {
+				if _, err := strconv.ParseFloat(value, 64); err != nil {
+					return AttributeError{Key: key, Name: name, Value: value}
+				}
+			}
+		}
+	}
+	return nil
+}
 
 // Entry Point and Non-Terminals
 
+// Parses a template, which has to be parsed completely. Otherwise, a
+// TemplateError points at the first part of the template that isn't valid,
+// and says what the parser expected there (see expect).
 func parseNameTemplate(template string) (Matcher, error) {
-	scanner := p.NewScanner([]byte(template))
-	r, _ := parseMaybe(scanner)
-	if result, ok := r.(Matcher); ok {
+	scanner := newFailureScanner(template)
+	r, s := expect("tag or filter", parseMaybe)(scanner)
+	_, s = s.SkipWS()
+	if result, ok := r.(Matcher); ok && s.Endof() {
 		return result, nil
-	} else {
-		return nil, fmt.Errorf("Not a valid name template: '%s'", template)
 	}
+	return nil, scanner.failure.templateError(r != nil, s.GetCursor())
 }
 
-// Maybe ("[template]")
+// Maybe ("[template]"), optionally with the probability of including it
+// ("[template]?0.3").
 func parseMaybe(s p.Scanner) (p.ParsecNode, p.Scanner) {
+	contents := expect("tag after '['", parseDisj)
+	closed := expect(fmt.Sprintf("']' to close '[' at col %d", column(s)), rbracket)
+
+	withProbability := p.And(func(ns []p.ParsecNode) p.ParsecNode {
+		return Maybe{
+			Matcher: ns[1].(Matcher),
+			Probability: ns[4].(float64),
+		}
+	}, lbracket, contents, closed, question, expect("probability from 0 to 1 after '?'", probability))
+
 	maybe := p.And(func(ns []p.ParsecNode) p.ParsecNode {
 		return Maybe{
-			ns[1].(Matcher),
+			Matcher: ns[1].(Matcher),
+			Probability: DefaultProbability,
 		}
-	}, lbracket, parseDisj, rbracket)
+	}, lbracket, contents, closed)
 
 	return p.OrdChoice(func(ns []p.ParsecNode) p.ParsecNode {
 		return ns[0].(Matcher)
-	}, maybe, parseDisj)(s)
+	}, withProbability, maybe, p.Parser(parseDisj))(s)
 }
 
+// The grammar has three levels of precedence, from lowest to highest:
+//
+//	disj  := conj ("|" conj)*
+//	conj  := ["+" | "-"] term (("+" | "-") term)*
+//	term  := group [filter] | attribute [filter] | tag [filter] | filter
+//	group := "(" disj ")"
+//
+// "-" (like "+") applies to a single term, which can be a group, so
+// "Male + (Boulder | Las Vegas) - (Dog | Animal)" is a conjunction of three
+// terms.
+
 // Disjunction: A (| B)*
 func parseDisj(s p.Scanner) (p.ParsecNode, p.Scanner) {
-	return p.Kleene(func(ns []p.ParsecNode) p.ParsecNode {
-		if len(ns) == 0 {
-			return nil
-		}
-
+	// Each "|" has to be followed by another conjunction, so a trailing "|"
+	// is left unparsed (and reported as an error).
+	tail := p.Kleene(func(ns []p.ParsecNode) p.ParsecNode {
 		terms := make([]And, len(ns))
 		for i, n := range(ns) {
 			terms[i] = n.(And)
 		}
-		return Or(terms)
-	}, parseConj, pipe)(s)
+		return terms
+	}, p.And(func(ns []p.ParsecNode) p.ParsecNode {
+		return ns[1]
+	}, pipe, expect("tag after '|'", parseConj)))
+
+	return p.And(func(ns []p.ParsecNode) p.ParsecNode {
+		t := ns[0].(And)
+		ts := ns[1].([]And)
+		return Or(append([]And{t}, ts...))
+	}, p.Parser(parseConj), tail)(s)
 }
 
 // Conjunction: A (+ B)*
@@ -133,11 +438,11 @@ func parseConj(s p.Scanner) (p.ParsecNode, p.Scanner) {
 	// number of AndTags or NotTags ("+ A" or "- A").
 	head := p.OrdChoice(func(ns []p.ParsecNode) p.ParsecNode {
 		return ns[0].(Matcher)
-	}, parseAndTag, parseNotTag, parseTerm)
+	}, p.Parser(parseAndTag), p.Parser(parseNotTag), p.Parser(parseTerm))
 
 	tailEntry := p.OrdChoice(func(ns []p.ParsecNode) p.ParsecNode {
 		return ns[0].(Matcher)
-	}, parseAndTag, parseNotTag)
+	}, p.Parser(parseAndTag), p.Parser(parseNotTag))
 
 	tail := p.Kleene(func(ns []p.ParsecNode) p.ParsecNode {
 		terms := make([]Matcher, len(ns))
@@ -158,21 +463,123 @@ func parseConj(s p.Scanner) (p.ParsecNode, p.Scanner) {
 func parseNotTag(s p.Scanner) (p.ParsecNode, p.Scanner) {
 	return p.And(func(ns []p.ParsecNode) p.ParsecNode {
 		return Not{ns[1].(Matcher)}
-	}, minus, parseTerm)(s)
+	}, minus, expect("tag after '-'", parseTerm))(s)
 }
 
 // An added tag (+ A)
 func parseAndTag(s p.Scanner) (p.ParsecNode, p.Scanner) {
 	return p.And(func(ns []p.ParsecNode) p.ParsecNode {
 		return ns[1].(Matcher)
-	}, plus, parseTerm)(s)
+	}, plus, expect("tag after '+'", parseTerm))(s)
 }
 
-// A term (tag, filter, or both).
+// A term (tag, filter, or both), or an attribute or parenthesized group
+// (optionally with a filter).
 func parseTerm(s p.Scanner) (p.ParsecNode, p.Scanner) {
+	// Groups and attributes are only parsed once, followed by an optional
+	// filter. (Trying them with a filter and then again without one would
+	// parse nested groups exponentially many times.)
+	optionalFilter := p.Maybe(func(ns []p.ParsecNode) p.ParsecNode {
+		return ns[0]
+	}, p.Parser(parseFilter))
+
+	withFilter := func(ns []p.ParsecNode) p.ParsecNode {
+		if filter, ok := ns[1].(Filter); ok {
+			return And{ns[0].(Matcher), filter}
+		}
+		return ns[0].(Matcher)
+	}
+
 	return p.OrdChoice(func(ns []p.ParsecNode) p.ParsecNode {
 		return ns[0].(Matcher)
-	}, parseFiltered, parseFilter, tag)(s)
+	}, p.And(withFilter, p.Parser(parseGroup), optionalFilter),
+		p.And(withFilter, p.Parser(parseAttribute), optionalFilter),
+		p.Parser(parseFiltered), p.Parser(parseFilter), p.Parser(tag))(s)
+}
+
+// A parenthesized group ("(A | B)"), which can contain any template (other
+// than an optional one).
+func parseGroup(s p.Scanner) (p.ParsecNode, p.Scanner) {
+	closed := expect(fmt.Sprintf("')' to close '(' at col %d", column(s)), rparen)
+	return p.And(func(ns []p.ParsecNode) p.ParsecNode {
+		return ns[1].(Matcher)
+	}, lparen, expect("tag after '('", parseDisj), closed)(s)
+}
+
+// An attribute comparison: "key=value", "key!=value", "key in (value1,
+// value2)", or a numeric comparison ("key>=1950" or "key in 1900..1950").
+func parseAttribute(s p.Scanner) (p.ParsecNode, p.Scanner) {
+	// The key is parsed first, so that what's expected after it can say
+	// which attribute it's for.
+	n, afterKey := attributeKey(s)
+	key, ok := n.(string)
+	if !ok {
+		return nil, s
+	}
+
+	equal := p.And(func(ns []p.ParsecNode) p.ParsecNode {
+		return Attribute{key, []string{string(ns[1].(Tag))}}
+	}, equals, expect(fmt.Sprintf("value after '%s='", key), tag))
+
+	notEqual := p.And(func(ns []p.ParsecNode) p.ParsecNode {
+		return Not{Attribute{key, []string{string(ns[1].(Tag))}}}
+	}, notEquals, expect(fmt.Sprintf("value after '%s!='", key), tag))
+
+	values := p.Many(func(ns []p.ParsecNode) p.ParsecNode {
+		vs := make([]string, len(ns))
+		for i, n := range(ns) {
+			vs[i] = string(n.(Tag))
+		}
+		return vs
+	}, p.Parser(tag), comma)
+
+	in := p.And(func(ns []p.ParsecNode) p.ParsecNode {
+		return Attribute{key, ns[2].([]string)}
+	}, inKeyword, lparen,
+		expect(fmt.Sprintf("value in list of values for '%s'", key), values),
+		expect(fmt.Sprintf("')' to close list of values for '%s'", key), rparen))
+
+	compare := func(s p.Scanner) (p.ParsecNode, p.Scanner) {
+		op, s2 := comparison(s)
+		if op == nil {
+			return nil, s
+		}
+		n, s3 := expect(fmt.Sprintf("number after '%s%s'", key, op), number)(s2)
+		if n == nil {
+			return nil, s
+		}
+		return Comparison{key, op.(string), n.(float64)}, s3
+	}
+
+	inRange := func(s p.Scanner) (p.ParsecNode, p.Scanner) {
+		ns, s2 := p.And(nil, inKeyword, p.Parser(number), dotDot)(s)
+		if ns == nil {
+			return nil, s
+		}
+		min := ns.([]p.ParsecNode)[1].(float64)
+		after := fmt.Sprintf("'%s in %v..'", key, min)
+		n, s3 := expect("number after "+after, number)(s2)
+		if n == nil {
+			return nil, s
+		}
+
+		// Ranges that can't match anything ("year in 1950..1900") aren't
+		// valid.
+		max := n.(float64)
+		if min > max {
+			expected(s2, fmt.Sprintf("number of at least %v after %s", min, after))
+			return nil, s
+		}
+		return Range{key, min, max}, s3
+	}
+
+	n, s2 := p.OrdChoice(func(ns []p.ParsecNode) p.ParsecNode {
+		return ns[0].(Matcher)
+	}, equal, notEqual, p.Parser(compare), p.Parser(inRange), in)(afterKey)
+	if n == nil {
+		return nil, s
+	}
+	return n, s2
 }
 
 // A filtered term (Term:filter)
@@ -182,12 +589,12 @@ func parseFiltered(s p.Scanner) (p.ParsecNode, p.Scanner) {
 			ns[0].(Tag),
 			ns[1].(Filter),
 		}
-	}, tag, parseFilter)(s)
+	}, p.Parser(tag), p.Parser(parseFilter))(s)
 }
 
 // A filter (:filter)
 func parseFilter(s p.Scanner) (p.ParsecNode, p.Scanner) {
 	return p.And(func(ns []p.ParsecNode) p.ParsecNode {
 		return ns[1].(Filter)
-	}, colon, filter)(s)
+	}, colon, expect("filter after ':'", filter))(s)
 }
@@ -1,8 +1,11 @@
-package main
+package names
 
 import (
 	"reflect"
+	"sort"
+	"strings"
 	. "testing"
+	"time"
 )
 
 func assertEquals(t *T, expected, actual interface{}) bool {
@@ -257,7 +260,7 @@ func TestFilters(t *T) {
 }
 
 func TestMaybe(t *T) {
-	// "[A]" -> (Maybe A)
+	// "[A]" -> (Maybe A 0.5)
 	result, _ := parseNameTemplate("[A]")
 	assertEquals(t,
 		Maybe{
@@ -266,10 +269,11 @@ func TestMaybe(t *T) {
 					Tag("A"),
 				}),
 			}),
+			0.5,
 		},
 		result)
 
-	// "[A + B | C:foo]" -> (Maybe (Or (And A B) (And C:foo)))
+	// "[A + B | C:foo]" -> (Maybe (Or (And A B) (And C:foo)) 0.5)
 	result, _ = parseNameTemplate("[A + B | C:foo]")
 	assertEquals(t,
 		Maybe{
@@ -282,10 +286,188 @@ func TestMaybe(t *T) {
 					Filtered{"C", "foo"},
 				}),
 			}),
+			0.5,
 		},
 		result)
 }
 
+func TestMaybeProbability(t *T) {
+	// "[A]?0.3" -> (Maybe A 0.3)
+	result, _ := parseNameTemplate("[A]?0.3")
+	assertEquals(t,
+		Maybe{Or([]And{And([]Matcher{Tag("A")})}), 0.3},
+		result)
+
+	// "[:given] ? .25" -> (Maybe :given 0.25)
+	result, _ = parseNameTemplate("[:given] ? .25")
+	assertEquals(t,
+		Maybe{Or([]And{And([]Matcher{Filter("given")})}), 0.25},
+		result)
+
+	result, _ = parseNameTemplate("[A]?1")
+	assertEquals(t,
+		Maybe{Or([]And{And([]Matcher{Tag("A")})}), 1.0},
+		result)
+
+	result, _ = parseNameTemplate("[A]?0")
+	assertEquals(t,
+		Maybe{Or([]And{And([]Matcher{Tag("A")})}), 0.0},
+		result)
+}
+
+func TestParseAttributeTemplates(t *T) {
+	result, _ := parseNameTemplate("era=1950s + region != Europe:first")
+	assertEquals(t,
+		Or([]And{
+			And([]Matcher{
+				Attribute{"era", []string{"1950s"}},
+				And{Not{Attribute{"region", []string{"Europe"}}}, Filter("first")},
+			}),
+		}),
+		result)
+
+	result, _ = parseNameTemplate("Male - era in (1940s, 1950s)")
+	assertEquals(t,
+		Or([]And{
+			And([]Matcher{
+				Tag("Male"),
+				Not{Attribute{"era", []string{"1940s", "1950s"}}},
+			}),
+		}),
+		result)
+}
+
+func TestParseNumericComparisons(t *T) {
+	result, _ := parseNameTemplate("year>=1950 + rank < 100:first | year in 1900..1950.5")
+	assertEquals(t,
+		Or([]And{
+			And([]Matcher{
+				Comparison{"year", ">=", 1950},
+				And{Comparison{"rank", "<", 100}, Filter("first")},
+			}),
+			And([]Matcher{
+				Range{"year", 1900, 1950.5},
+			}),
+		}),
+		result)
+
+	result, _ = parseNameTemplate("- delta<=-0.5 - delta>2")
+	assertEquals(t,
+		Or([]And{
+			And([]Matcher{
+				Not{Comparison{"delta", "<=", -0.5}},
+				Not{Comparison{"delta", ">", 2}},
+			}),
+		}),
+		result)
+}
+
+func TestMatchNumericComparisons(t *T) {
+	props := Properties{Attributes: map[string][]string{
+		"year": []string{"1950", "1962"},
+		"rank": []string{"unknown"},
+	}}
+	assertEquals(t, true, Comparison{"year", ">=", 1962}.Matches(props))
+	assertEquals(t, true, Comparison{"Year", "<", 1951}.Matches(props))
+	assertEquals(t, false, Comparison{"year", ">", 1962}.Matches(props))
+	assertEquals(t, false, Comparison{"year", "<=", 1949}.Matches(props))
+	assertEquals(t, true, Range{"year", 1955, 1965}.Matches(props))
+	assertEquals(t, true, Range{"year", 1900, 1950}.Matches(props))
+	assertEquals(t, false, Range{"year", 1951, 1961}.Matches(props))
+	assertEquals(t, false, Comparison{"rank", "<", 100}.Matches(props))
+	assertEquals(t, false, Comparison{"missing", "<", 100}.Matches(props))
+}
+
+func TestMatchAttributes(t *T) {
+	props := Properties{Attributes: map[string][]string{"era": []string{"1950s", "1960s"}}}
+	assertEquals(t, true, Attribute{"Era", []string{"1960S"}}.Matches(props))
+	assertEquals(t, true, Attribute{"era", []string{"1940s", "1950s"}}.Matches(props))
+	assertEquals(t, false, Attribute{"era", []string{"1940s"}}.Matches(props))
+	assertEquals(t, false, Attribute{"region", []string{"1950s"}}.Matches(props))
+}
+
+func TestParseGroups(t *T) {
+	// "Male + (Boulder | Las Vegas) - (Dog | Animal)"
+	// -> (Or (And (Tag "Male")
+	//             (Or (And (Tag "Boulder")) (And (Tag "Las Vegas")))
+	//             (Not (Or (And (Tag "Dog")) (And (Tag "Animal"))))))
+	result, _ := parseNameTemplate("Male + (Boulder | Las Vegas) - (Dog | Animal)")
+	assertEquals(t,
+		Or([]And{
+			And([]Matcher{
+				Tag("Male"),
+				Or([]And{
+					And([]Matcher{Tag("Boulder")}),
+					And([]Matcher{Tag("Las Vegas")}),
+				}),
+				Not{Or([]And{
+					And([]Matcher{Tag("Dog")}),
+					And([]Matcher{Tag("Animal")}),
+				})},
+			}),
+		}),
+		result)
+
+	// "((A | B + C) - D):first | E"
+	result, _ = parseNameTemplate("((A | B + C) - D):first | E")
+	assertEquals(t,
+		Or([]And{
+			And([]Matcher{
+				And{
+					Or([]And{
+						And([]Matcher{
+							Or([]And{
+								And([]Matcher{Tag("A")}),
+								And([]Matcher{Tag("B"), Tag("C")}),
+							}),
+							Not{Tag("D")},
+						}),
+					}),
+					Filter("first"),
+				},
+			}),
+			And([]Matcher{Tag("E")}),
+		}),
+		result)
+}
+
+func TestParseDeeplyNestedGroups(t *T) {
+	start := time.Now()
+	nested := strings.Repeat("(", 40) + "Boulder" + strings.Repeat(")", 40)
+
+	result, err := parseNameTemplate(nested + ":first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEquals(t, true, result.Matches(Properties{Tags: []Tag{"Boulder"}, First: true}))
+	assertEquals(t, false, result.Matches(Properties{Tags: []Tag{"Boulder"}, Last: true}))
+
+	_, err = parseNameTemplate(nested[1:])
+	assertEquals(t, TemplateError{Template: nested[1:], Column: 86, Message: "unexpected ')'"}, err)
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Parsing nested groups took %v", elapsed)
+	}
+}
+
+func TestGroupsKeepPrecedence(t *T) {
+	// Grouping the terms that would bind together anyway doesn't change what
+	// a template matches.
+	for _, templates := range([][]string{
+		{"Foo + Bar | Fizz - Buzz", "(Foo + Bar) | (Fizz - Buzz)"},
+		{"Alpha - Beta - Gamma", "((Alpha - Beta) - Gamma)"},
+	}) {
+		flat, _ := parseNameTemplate(templates[0])
+		grouped, _ := parseNameTemplate(templates[1])
+		for _, tags := range([][]Tag{
+			{"Foo", "Bar"}, {"Fizz"}, {"Fizz", "Buzz"}, {"Alpha"}, {"Alpha", "Gamma"},
+		}) {
+			props := Properties{Tags: tags}
+			assertEquals(t, flat.Matches(props), grouped.Matches(props))
+		}
+	}
+}
+
 func TestParsingGarbage(t *T) {
 	result, err := parseNameTemplate("% J#QOQ# ^#Q#")
 	if err == nil {
@@ -293,3 +475,202 @@ func TestParsingGarbage(t *T) {
 	}
 	assertEquals(t, nil, result)
 }
+
+// Returns the distinct names from test.names that match a template, sorted.
+func matchTestNames(t *T, template string) []string {
+	matcher, err := parseNameTemplate(template)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dict := make(NameDictionary)
+	entries, err := parseNameFile("test.names")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for entry := range(entries) {
+		dict.AddEntry(entry)
+	}
+
+	var names []string
+	for name, props := range(dict) {
+		if matchesName(matcher, props) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestMatchTag(t *T) {
+	assertEquals(t,
+		[]string{"Tolkein"},
+		matchTestNames(t, "Classic"))
+
+	assertEquals(t,
+		[]string(nil),
+		matchTestNames(t, "Missing"))
+}
+
+func TestMatchInheritedTag(t *T) {
+	// Tags from enclosing blocks apply to everything nested inside them.
+	assertEquals(t,
+		[]string{"Tolkein"},
+		matchTestNames(t, "Just Foo + What What + Hello + Classic"))
+
+	assertEquals(t,
+		[]string{
+			"Arnold", "Benedict", "Douglas", "George",
+			"James", "Martin",
+		},
+		matchTestNames(t, "Fizz"))
+
+	// Tags do not leak into sibling blocks or names after the block closes.
+	assertEquals(t,
+		[]string{"Doe", "Goldsmith", "Jane", "John", "Peter", "Redman", "Smith"},
+		matchTestNames(t, "Just Foo - Bar - What What"))
+}
+
+func TestMatchFilter(t *T) {
+	assertEquals(t,
+		[]string{"Arnold", "Doe", "Douglas", "Goldsmith", "Martin", "Redman", "Smith", "Tolkein", "Wallace"},
+		matchTestNames(t, ":last"))
+
+	assertEquals(t,
+		[]string{"Jimmy"},
+		matchTestNames(t, ":nick"))
+}
+
+func TestMatchFiltered(t *T) {
+	assertEquals(t,
+		[]string{"Benedict", "George", "James"},
+		matchTestNames(t, "Bar:first"))
+
+	assertEquals(t,
+		[]string{"Arnold", "Doe", "Douglas", "Goldsmith", "Martin", "Redman", "Smith", "Tolkein"},
+		matchTestNames(t, "Just Foo:last"))
+
+	assertEquals(t,
+		[]string{"Martin"},
+		matchTestNames(t, "Fantasy:last"))
+}
+
+func TestMatchAnd(t *T) {
+	assertEquals(t,
+		[]string{"George", "Martin"},
+		matchTestNames(t, "Bar + Fantasy"))
+
+	assertEquals(t,
+		[]string{"George"},
+		matchTestNames(t, "Bar:first + Fantasy"))
+}
+
+func TestMatchOr(t *T) {
+	assertEquals(t,
+		[]string{"Tolkein", "Wallace", "William"},
+		matchTestNames(t, "Classic | - Just Foo"))
+
+	assertEquals(t,
+		[]string{"Martin", "Tolkein"},
+		matchTestNames(t, "Classic:last | Fantasy:last"))
+}
+
+func TestMatchNot(t *T) {
+	assertEquals(t,
+		[]string{"Wallace", "William"},
+		matchTestNames(t, "- Just Foo"))
+
+	assertEquals(t,
+		[]string{"Arnold", "Benedict", "Douglas", "James"},
+		matchTestNames(t, "Bar - Fantasy"))
+
+	assertEquals(t,
+		[]string{"Doe", "Goldsmith", "Redman", "Smith", "Tolkein"},
+		matchTestNames(t, "Just Foo:last - Bar"))
+}
+
+func TestMatchGroups(t *T) {
+	assertEquals(t,
+		[]string{"Martin", "Tolkein"},
+		matchTestNames(t, "(Classic | Fantasy):last"))
+
+	assertEquals(t,
+		[]string{"Doe", "Goldsmith", "Redman", "Smith"},
+		matchTestNames(t, "Just Foo + :last - (Bar | Hello)"))
+}
+
+func TestMatchMaybe(t *T) {
+	// Maybe only affects whether a component is generated, not what it
+	// matches.
+	assertEquals(t,
+		[]string{"Benedict", "George", "James"},
+		matchTestNames(t, "[Bar:first]"))
+}
+
+func TestMatchNicknames(t *T) {
+	// Nicknames are only returned when :nick is asked for.
+	assertEquals(t,
+		[]string{"Jimmy"},
+		matchTestNames(t, "Bar:nick"))
+
+	assertEquals(t,
+		[]string{"Arnold", "Benedict", "Douglas", "James", "Jimmy"},
+		matchTestNames(t, "Bar - Fantasy | :nick"))
+
+	assertEquals(t,
+		[]string{"Jimmy"},
+		matchTestNames(t, "[:nick]"))
+
+	// Negating :nick doesn't ask for nicknames.
+	assertEquals(t,
+		[]string{"Arnold", "Benedict", "Douglas", "James"},
+		matchTestNames(t, "Bar - Fantasy - :nick"))
+}
+
+func TestMatchInitials(t *T) {
+	// Initials are only returned when :initial is asked for.
+	assertEquals(t,
+		[]string{"J.R.R.", "R."},
+		matchTestNames(t, ":initial"))
+
+	assertEquals(t,
+		[]string{"R."},
+		matchTestNames(t, "Fantasy:initial"))
+
+	assertEquals(t,
+		[]string{"George", "Martin", "R."},
+		matchTestNames(t, "Fantasy - :nick | Fantasy:initial"))
+}
+
+func TestUnicodeTemplates(t *T) {
+	result, _ := parseNameTemplate("España + Éire:last - 日本")
+	assertEquals(t,
+		Or([]And{
+			And([]Matcher{
+				Tag("España"),
+				Filtered{"Éire", "last"},
+				Not{Tag("日本")},
+			}),
+		}),
+		result)
+}
+
+func TestApostropheTemplates(t *T) {
+	result, _ := parseNameTemplate("O'Brien Family:last - D’Arcy")
+	assertEquals(t,
+		Or([]And{
+			And([]Matcher{
+				Filtered{"O'Brien Family", "last"},
+				Not{Tag("D’Arcy")},
+			}),
+		}),
+		result)
+}
+
+func TestMatchTagIgnoresCase(t *T) {
+	props := Properties{Tags: []Tag{"Éire", "ΣΊΣΥΦΟΣ"}}
+	assertEquals(t, true, Tag("éire").Matches(props))
+	assertEquals(t, true, Tag("ÉIRE").Matches(props))
+	assertEquals(t, true, Tag("σίσυφος").Matches(props))
+	assertEquals(t, false, Tag("eire").Matches(props))
+}
@@ -0,0 +1,227 @@
+package names
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The filters a template can use (see Filter).
+var knownFilters = []string{"first", "given", "last", "nick", "initial"}
+
+// Returned when a template uses a tag that isn't on any of the loaded names
+// (or declared in a tag hierarchy), along with any known tags it might be a
+// typo of.
+type UnknownTagError struct {
+	Tag Tag
+	Suggestions []string
+}
+
+func (e UnknownTagError) Error() string {
+	return fmt.Sprintf("Unknown tag '%s'%s", e.Tag, didYouMean(e.Suggestions, ""))
+}
+
+// Returned when a template uses a filter that doesn't exist.
+type UnknownFilterError struct {
+	Filter Filter
+	Suggestions []string
+}
+
+func (e UnknownFilterError) Error() string {
+	return fmt.Sprintf("Unknown filter '%v'%s", e.Filter, didYouMean(e.Suggestions, ":"))
+}
+
+func didYouMean(suggestions []string, prefix string) string {
+	if len(suggestions) == 0 {
+		return ""
+	}
+	quoted := make([]string, len(suggestions))
+	for i, s := range(suggestions) {
+		quoted[i] = fmt.Sprintf("'%s%s'", prefix, s)
+	}
+	return fmt.Sprintf(" (did you mean %s?)", strings.Join(quoted, " or "))
+}
+
+// Checks that every tag and filter in the templates is known: tags have to be
+// on at least one loaded name or declared in the tag hierarchy, and filters
+// have to be one of the supported filters. Returns an UnknownTagError or
+// UnknownFilterError (as Errors) for each one that isn't, once per tag or
+// filter.
+func (g *Generator) Validate(templates ...Matcher) error {
+	known := g.knownTags()
+	var tags []string
+	for _, tag := range(known) {
+		tags = append(tags, tag)
+	}
+	reported := make(map[string]bool)
+
+	var errs Errors
+	for _, template := range(templates) {
+		for _, tag := range(templateTags(template)) {
+			key := strings.ToLower(string(tag))
+			if known[key] != "" || reported["tag "+key] {
+				continue
+			}
+			reported["tag "+key] = true
+			errs = append(errs, UnknownTagError{tag, suggest(string(tag), tags)})
+		}
+
+		for _, filter := range(templateFilters(template)) {
+			if containsFold(knownFilters, string(filter)) || reported["filter "+string(filter)] {
+				continue
+			}
+			reported["filter "+string(filter)] = true
+			errs = append(errs, UnknownFilterError{filter, suggest(string(filter), knownFilters)})
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Returns every tag on the loaded names and in the tag hierarchy, keyed by
+// their lower case form.
+func (g *Generator) knownTags() map[string]string {
+	known := make(map[string]string)
+	add := func(tag string) {
+		if key := strings.ToLower(tag); known[key] == "" {
+			known[key] = tag
+		}
+	}
+
+	for _, props := range(g.Dictionary) {
+		for _, tag := range(props.Tags) {
+			add(string(tag))
+		}
+	}
+	for _, d := range(g.Tags.declarations) {
+		add(d.Tag)
+		for _, tag := range(d.Tags) {
+			add(tag)
+		}
+	}
+	return known
+}
+
+// Returns every tag a template matches on, including negated ones.
+func templateTags(m Matcher) []Tag {
+	switch m := m.(type) {
+	case Tag:
+		return []Tag{m}
+	case Filtered:
+		return []Tag{m.Tag}
+	case Maybe:
+		return templateTags(m.Matcher)
+	case Not:
+		return templateTags(m.Matcher)
+	case And:
+		var tags []Tag
+		for _, term := range(m) {
+			tags = append(tags, templateTags(term)...)
+		}
+		return tags
+	case Or:
+		var tags []Tag
+		for _, term := range(m) {
+			tags = append(tags, templateTags(term)...)
+		}
+		return tags
+	}
+	return nil
+}
+
+// Returns every filter in a template, including negated ones.
+func templateFilters(m Matcher) []Filter {
+	switch m := m.(type) {
+	case Filter:
+		return []Filter{m}
+	case Filtered:
+		return []Filter{m.Filter}
+	case Maybe:
+		return templateFilters(m.Matcher)
+	case Not:
+		return templateFilters(m.Matcher)
+	case And:
+		var filters []Filter
+		for _, term := range(m) {
+			filters = append(filters, templateFilters(term)...)
+		}
+		return filters
+	case Or:
+		var filters []Filter
+		for _, term := range(m) {
+			filters = append(filters, templateFilters(term)...)
+		}
+		return filters
+	}
+	return nil
+}
+
+// Returns the candidates closest to a misspelled word (by edit distance,
+// ignoring case), if any are close enough to be a likely typo. At most three
+// are returned, sorted.
+func suggest(word string, candidates []string) []string {
+	// Allow one edit for every three characters, so that short words don't
+	// match everything.
+	best := len([]rune(word))/3 + 1
+
+	var closest []string
+	for _, c := range(candidates) {
+		d := editDistance(strings.ToLower(word), strings.ToLower(c))
+		if d < best {
+			best, closest = d, nil
+		}
+		if d == best {
+			closest = append(closest, c)
+		}
+	}
+
+	sort.Strings(closest)
+	if len(closest) > 3 {
+		closest = closest[:3]
+	}
+	return closest
+}
+
+// The Damerau-Levenshtein (optimal string alignment) distance between two
+// strings, in characters: the number of insertions, deletions, substitutions
+// and swaps of adjacent characters needed to turn one into the other.
+func editDistance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+
+	// Only the last three rows of the table are needed.
+	prev2 := make([]int, len(t)+1)
+	prev := make([]int, len(t)+1)
+	row := make([]int, len(t)+1)
+	for j := range(prev) {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(s); i++ {
+		row[0] = i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			row[j] = minInt(prev[j]+1, row[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				row[j] = minInt(row[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, row = prev, row, prev2
+	}
+	return prev[len(t)]
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range(values[1:]) {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
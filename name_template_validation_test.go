@@ -0,0 +1,84 @@
+package names
+
+import (
+	. "testing"
+)
+
+func TestEditDistance(t *T) {
+	assertEquals(t, 0, editDistance("Boulder", "Boulder"))
+	assertEquals(t, 1, editDistance("Bolder", "Boulder"))
+	assertEquals(t, 1, editDistance("frist", "first"))
+	assertEquals(t, 3, editDistance("Reno", "Rome"))
+	assertEquals(t, 3, editDistance("", "Dog"))
+	assertEquals(t, 1, editDistance("Eire", "Éire"))
+}
+
+func TestSuggest(t *T) {
+	tags := []string{"Boulder", "Las Vegas", "Male", "Female", "Dog"}
+	assertEquals(t, []string{"Boulder"}, suggest("bolder", tags))
+	assertEquals(t, []string{"Las Vegas"}, suggest("LasVegas", tags))
+	assertEquals(t, []string{"Female"}, suggest("Femal", tags))
+	assertEquals(t, []string{"Dog", "Male"}, suggest("Dole", []string{"Male", "Dog", "Dolores"}))
+	assertEquals(t, []string(nil), suggest("Cat", tags))
+	assertEquals(t, []string(nil), suggest("Boston", tags))
+}
+
+func TestValidateTemplates(t *T) {
+	g := testGenerator(t)
+	err := g.Validate(
+		mustParseTemplate(t, "Bolder:last"),
+		mustParseTemplate(t, ":frist"),
+		mustParseTemplate(t, "Las Vegas + (Male | Femal) - Cat:nick"),
+		mustParseTemplate(t, "[bolder:gvien]"))
+
+	assertEquals(t, Errors{
+		UnknownTagError{"Bolder", []string{"Boulder"}},
+		UnknownFilterError{"frist", []string{"first"}},
+		UnknownTagError{"Femal", []string{"Female"}},
+		UnknownTagError{"Cat", nil},
+		UnknownFilterError{"gvien", []string{"given"}},
+	}, err)
+}
+
+func TestValidateKnownTemplates(t *T) {
+	g := testGenerator(t)
+	assertEquals(t, nil, g.Validate(
+		mustParseTemplate(t, "boulder + MALE:first"),
+		mustParseTemplate(t, "[:given]?0.3"),
+		mustParseTemplate(t, ":nick | :initial - Dog")))
+}
+
+func TestValidateDeclaredTags(t *T) {
+	g := NewGenerator()
+	if err := g.LoadFiles("testdata/hierarchy.names"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Parent tags and aliases don't have to be on any names.
+	assertEquals(t, nil, g.Validate(mustParseTemplate(t, "USA + Nevada - Man")))
+	assertEquals(t,
+		Errors{UnknownTagError{"Nevda", []string{"Nevada"}}},
+		g.Validate(mustParseTemplate(t, "Nevda")))
+}
+
+func TestUnknownTagErrorMessages(t *T) {
+	assertEquals(t, "Unknown tag 'Bolder' (did you mean 'Boulder'?)",
+		UnknownTagError{"Bolder", []string{"Boulder"}}.Error())
+	assertEquals(t, "Unknown tag 'Mael' (did you mean 'Male' or 'Mel'?)",
+		UnknownTagError{"Mael", []string{"Male", "Mel"}}.Error())
+	assertEquals(t, "Unknown tag 'Cat'", UnknownTagError{"Cat", nil}.Error())
+	assertEquals(t, "Unknown filter ':frist' (did you mean ':first'?)",
+		UnknownFilterError{"frist", []string{"first"}}.Error())
+}
+
+func TestGenerateUnknownTags(t *T) {
+	g := testGenerator(t)
+	_, err := g.Generate(mustParseTemplate(t, "Male:frist"), mustParseTemplate(t, "Bolder:last"))
+	assertEquals(t, Errors{
+		UnknownFilterError{"frist", []string{"first"}},
+		UnknownTagError{"Bolder", []string{"Boulder"}},
+	}, err)
+
+	_, err = g.GeneratePattern(mustParsePattern(t, "{:first} [{Bolder:given}] {:last}"))
+	assertEquals(t, Errors{UnknownTagError{"Bolder", []string{"Boulder"}}}, err)
+}
@@ -0,0 +1,56 @@
+package names
+
+// A source of names, like a name file or a table of names.
+type Source interface {
+	// Returns every name component in the source. If the source has errors,
+	// any entries that could still be read are returned along with them.
+	Entries() (<-chan Entry, error)
+}
+
+// A name file, in the format described in the README.
+type NameFile string
+
+func (f NameFile) Entries() (<-chan Entry, error) {
+	return parseNameFile(string(f))
+}
+
+// Reads the entries from all of the specified sources, in order. Every error
+// from every source is returned (as Errors).
+func loadSources(sources []Source) (<-chan Entry, error) {
+	var errs Errors
+	var sourceEntries []<-chan Entry
+	for _, source := range(sources) {
+		entries, err := source.Entries()
+		errs = appendErrors(errs, err)
+		if entries != nil {
+			sourceEntries = append(sourceEntries, entries)
+		}
+	}
+
+	entries := make(chan Entry)
+
+	go func() {
+		defer close(entries)
+		for _, es := range(sourceEntries) {
+			for entry := range(es) {
+				entries <- entry
+			}
+		}
+	}()
+
+	if len(errs) > 0 {
+		return entries, errs
+	}
+	return entries, nil
+}
+
+// Adds an error to a list of errors, flattening any lists of errors.
+func appendErrors(errs Errors, err error) Errors {
+	switch err := err.(type) {
+	case nil:
+		return errs
+	case Errors:
+		return append(errs, err...)
+	}
+	return append(errs, err)
+}
@@ -0,0 +1,239 @@
+package names
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A relation between tags declared in a name file, either a hierarchy
+// ("tag Nevada > Las Vegas, Reno") or an alias ("alias M = Male").
+type TagDeclaration struct {
+	// "tag" if Tags are sub-tags of Tag, or "alias" if Tags are other names
+	// for Tag.
+	Kind string `json:"kind" yaml:"kind"`
+	Tag string `json:"tag" yaml:"tag"`
+	Tags []string `json:"tags" yaml:"tags"`
+}
+
+func (d TagDeclaration) String() string {
+	switch d.Kind {
+	case "":
+		return ""
+	case "alias":
+		return fmt.Sprintf("alias %s = %s", strings.Join(d.Tags, ", "), d.Tag)
+	}
+	return fmt.Sprintf("tag %s > %s", d.Tag, strings.Join(d.Tags, ", "))
+}
+
+// The tag relations declared in name files. Names are matched by a tag if
+// they have the tag, any of its aliases, or any tag under it in the
+// hierarchy. Like tags themselves, declarations are case insensitive.
+type TagHierarchy struct {
+	declarations []TagDeclaration
+
+	// The tag each alias stands for, the aliases declared for each tag, and
+	// the parents declared for each tag, all as they were declared (so
+	// aliases are resolved when the hierarchy is used). Keys are lower case.
+	canonical map[string]string
+	aliases map[string][]string
+	parents map[string][]string
+}
+
+// Adds a declaration to the hierarchy. Declarations that would make a tag its
+// own ancestor (or alias) are rejected with an error, and not added.
+func (h *TagHierarchy) Declare(d TagDeclaration) error {
+	if d.Kind != "tag" && d.Kind != "alias" {
+		return fmt.Errorf("Unknown tag declaration: '%s'", d.Kind)
+	}
+	if h.canonical == nil {
+		h.canonical = make(map[string]string)
+		h.aliases = make(map[string][]string)
+		h.parents = make(map[string][]string)
+	}
+
+	// Each part of the declaration is added and checked in turn, and undone
+	// if the declaration is rejected.
+	var undo []func()
+	var err error
+	if d.Kind == "alias" {
+		for _, alias := range(d.Tags) {
+			if err = h.declareAlias(alias, d.Tag, &undo); err != nil {
+				break
+			}
+		}
+	} else {
+		for _, child := range(d.Tags) {
+			if err = h.declareParent(child, d.Tag, &undo); err != nil {
+				break
+			}
+		}
+	}
+
+	if err != nil {
+		for i := len(undo) - 1; i >= 0; i-- {
+			undo[i]()
+		}
+		return fmt.Errorf("Invalid tag declaration '%v': %v", d, err)
+	}
+	h.declarations = append(h.declarations, d)
+	return nil
+}
+
+func (h *TagHierarchy) declareAlias(alias, tag string, undo *[]func()) error {
+	key := strings.ToLower(alias)
+	if target, ok := h.canonical[key]; ok {
+		if !strings.EqualFold(target, tag) {
+			return fmt.Errorf("'%s' is already an alias for '%s'", alias, target)
+		}
+		return nil
+	}
+
+	// Following aliases has to end at a tag that isn't an alias.
+	chain := []string{alias}
+	for t, ok := tag, true; ok; t, ok = h.canonical[strings.ToLower(t)] {
+		cycle := strings.EqualFold(t, alias)
+		chain = append(chain, t)
+		if cycle {
+			return fmt.Errorf("alias cycle: %s", strings.Join(chain, " = "))
+		}
+	}
+
+	target := strings.ToLower(tag)
+	h.canonical[key] = tag
+	h.aliases[target] = append(h.aliases[target], alias)
+	*undo = append(*undo, func() {
+		delete(h.canonical, key)
+		h.aliases[target] = h.aliases[target][:len(h.aliases[target])-1]
+	})
+
+	// The alias and the tag are now the same tag, which can't be under
+	// itself.
+	if cycle := h.findCycle(h.resolveAlias(tag)); cycle != nil {
+		return fmt.Errorf("tag cycle: %s", strings.Join(cycle, " > "))
+	}
+	return nil
+}
+
+func (h *TagHierarchy) declareParent(child, parent string, undo *[]func()) error {
+	key := strings.ToLower(child)
+	if containsFold(h.parents[key], parent) {
+		return nil
+	}
+
+	h.parents[key] = append(h.parents[key], parent)
+	*undo = append(*undo, func() {
+		h.parents[key] = h.parents[key][:len(h.parents[key])-1]
+	})
+
+	if cycle := h.findCycle(h.resolveAlias(child)); cycle != nil {
+		return fmt.Errorf("tag cycle: %s", strings.Join(cycle, " > "))
+	}
+	return nil
+}
+
+// Returns a set of tags along with every alias and ancestor of them.
+func (h *TagHierarchy) Expand(tags []Tag) []Tag {
+	if len(h.declarations) == 0 {
+		return tags
+	}
+
+	seen := make(map[string]bool)
+	var expanded []Tag
+
+	var add func(tag string)
+	add = func(tag string) {
+		tag = h.resolveAlias(tag)
+		key := strings.ToLower(tag)
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+
+		names := h.names(tag)
+		for _, name := range(names) {
+			expanded = append(expanded, Tag(name))
+		}
+		for _, name := range(names) {
+			for _, parent := range(h.parents[strings.ToLower(name)]) {
+				add(parent)
+			}
+		}
+	}
+
+	for _, tag := range(tags) {
+		add(string(tag))
+	}
+	return expanded
+}
+
+// Returns the tag an alias stands for, or the tag itself if it isn't an alias.
+func (h *TagHierarchy) resolveAlias(tag string) string {
+	for {
+		target, ok := h.canonical[strings.ToLower(tag)]
+		if !ok {
+			return tag
+		}
+		tag = target
+	}
+}
+
+// Returns a tag followed by all of its aliases (including aliases of its
+// aliases).
+func (h *TagHierarchy) names(tag string) []string {
+	names := []string{tag}
+	for i := 0; i < len(names); i++ {
+		for _, alias := range(h.aliases[strings.ToLower(names[i])]) {
+			if !containsFold(names, alias) {
+				names = append(names, alias)
+			}
+		}
+	}
+	return names
+}
+
+// Returns a path of tags from a tag, up through its ancestors, back to itself
+// (if there is one), reading from parent to child. Each tag is only searched
+// once, so this takes linear time even for hierarchies with many paths
+// between the same tags.
+func (h *TagHierarchy) findCycle(start string) []string {
+	visited := make(map[string]bool)
+	var path []string
+
+	var visit func(tag string) bool
+	visit = func(tag string) bool {
+		for _, name := range(h.names(tag)) {
+			for _, parent := range(h.parents[strings.ToLower(name)]) {
+				parent = h.resolveAlias(parent)
+				if strings.EqualFold(parent, start) {
+					path = append(path, parent)
+					return true
+				}
+
+				key := strings.ToLower(parent)
+				if visited[key] {
+					continue
+				}
+				visited[key] = true
+				if visit(parent) {
+					path = append(path, parent)
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	if !visit(start) {
+		return nil
+	}
+	return append(path, start)
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range(list) {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package names
+
+import (
+	"fmt"
+	. "testing"
+	"time"
+)
+
+func testHierarchy(t *T, declarations ...TagDeclaration) *TagHierarchy {
+	var h TagHierarchy
+	for _, d := range(declarations) {
+		if err := h.Declare(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &h
+}
+
+func TestExpandHierarchy(t *T) {
+	h := testHierarchy(t,
+		TagDeclaration{Kind: "tag", Tag: "Nevada", Tags: []string{"Las Vegas", "Reno"}},
+		TagDeclaration{Kind: "tag", Tag: "USA", Tags: []string{"Nevada"}})
+
+	assertEquals(t, []Tag{"Las Vegas", "Nevada", "USA", "Male"},
+		h.Expand([]Tag{"Las Vegas", "Male"}))
+	assertEquals(t, []Tag{"reno", "Nevada", "USA"}, h.Expand([]Tag{"reno"}))
+	assertEquals(t, []Tag{"USA"}, h.Expand([]Tag{"USA"}))
+}
+
+func TestExpandAliases(t *T) {
+	h := testHierarchy(t,
+		TagDeclaration{Kind: "alias", Tag: "Male", Tags: []string{"M"}},
+		TagDeclaration{Kind: "alias", Tag: "M", Tags: []string{"Man"}},
+		TagDeclaration{Kind: "tag", Tag: "Person", Tags: []string{"Man"}})
+
+	assertEquals(t, []Tag{"Male", "M", "Man", "Person"}, h.Expand([]Tag{"Man"}))
+	assertEquals(t, []Tag{"Male", "M", "Man", "Person"}, h.Expand([]Tag{"Male"}))
+}
+
+func TestDeclareCycles(t *T) {
+	h := testHierarchy(t,
+		TagDeclaration{Kind: "tag", Tag: "USA", Tags: []string{"Nevada"}},
+		TagDeclaration{Kind: "tag", Tag: "Nevada", Tags: []string{"Las Vegas"}},
+		TagDeclaration{Kind: "alias", Tag: "Male", Tags: []string{"M"}})
+
+	err := h.Declare(TagDeclaration{Kind: "tag", Tag: "Las Vegas", Tags: []string{"USA"}})
+	assertEquals(t, "Invalid tag declaration 'tag Las Vegas > USA': "+
+		"tag cycle: USA > Nevada > Las Vegas > USA", err.Error())
+
+	err = h.Declare(TagDeclaration{Kind: "alias", Tag: "M", Tags: []string{"Male"}})
+	assertEquals(t, "Invalid tag declaration 'alias Male = M': "+
+		"alias cycle: Male = M = Male", err.Error())
+
+	err = h.Declare(TagDeclaration{Kind: "alias", Tag: "Nevada", Tags: []string{"las vegas"}})
+	assertEquals(t, "Invalid tag declaration 'alias las vegas = Nevada': "+
+		"tag cycle: Nevada > Nevada", err.Error())
+
+	err = h.Declare(TagDeclaration{Kind: "alias", Tag: "Female", Tags: []string{"M"}})
+	assertEquals(t, "Invalid tag declaration 'alias M = Female': "+
+		"'M' is already an alias for 'Male'", err.Error())
+
+	// Rejected declarations aren't added.
+	assertEquals(t, []Tag{"Las Vegas", "Nevada", "USA"}, h.Expand([]Tag{"Las Vegas"}))
+	assertEquals(t, []Tag{"Male", "M"}, h.Expand([]Tag{"M"}))
+}
+
+func TestDeclareDiamonds(t *T) {
+	// Each level has two tags under both tags of the level above, so there
+	// are 2^50 paths from the bottom of the hierarchy to the top.
+	start := time.Now()
+	h := &TagHierarchy{}
+	for i := 1; i <= 50; i++ {
+		err := h.Declare(TagDeclaration{
+			Kind: "tag",
+			Tag: fmt.Sprintf("A%d", i-1),
+			Tags: []string{fmt.Sprintf("A%d", i), fmt.Sprintf("B%d", i)},
+		})
+		if err == nil {
+			err = h.Declare(TagDeclaration{
+				Kind: "tag",
+				Tag: fmt.Sprintf("B%d", i-1),
+				Tags: []string{fmt.Sprintf("A%d", i), fmt.Sprintf("B%d", i)},
+			})
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := h.Declare(TagDeclaration{Kind: "tag", Tag: "B50", Tags: []string{"A0"}})
+	if err == nil {
+		t.Error("Expected a tag cycle")
+	}
+	assertEquals(t, 101, len(h.Expand([]Tag{"A50"})))
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Declaring the hierarchy took %v", elapsed)
+	}
+}
@@ -1,11 +1,16 @@
-package main
+package names
 
 import (
+	"strconv"
 	"strings"
 
 	p "github.com/prataprc/goparsec"
 )
 
+// Parsers declared as functions (like tag and filter) are passed to
+// combinators as p.Parser(tag), since the combinators only accept p.Parser
+// values.
+
 func trimmedTerminal(pattern, name string) p.Parser {
 	term := p.Token(pattern, name)
 	return func(s p.Scanner) (p.ParsecNode, p.Scanner) {
@@ -18,8 +23,28 @@ func trimmedTerminal(pattern, name string) p.Parser {
 	}
 }
 
-var comment = p.Token(`^//.*\n`, "COMMENT")
-var name = trimmedTerminal(`^[0-9a-zA-Z\.\-_ "']+`, "NAME")
+// Line ("// ...") and block ("/* ... */") comments. Line comments run to the
+// end of the line or the end of the input, whichever comes first.
+var comment = p.Token(`^(//.*|/\*(?s:.*?)\*/)`, "COMMENT")
+
+// A comment on the same line as whatever comes before it (like a name or a
+// closing brace), rather than on a line of its own.
+var trailingComment = p.TokenExact(`[ \t]*(//.*|/\*(?s:.*?)\*/)`, "TRAILING_COMMENT")
+
+// The keyword and quoted path of an include statement.
+var include = p.Token(`^(include|@import)[ \t]+"[^"\n]+"`, "INCLUDE")
+
+// Keywords for declaring tag hierarchies and aliases.
+var tagKeyword = p.Token(`^tag[ \t]+`, "TAG_KEYWORD")
+var aliasKeyword = p.Token(`^alias[ \t]+`, "ALIAS_KEYWORD")
+
+// Names and tags can contain letters and digits from any script, including
+// combining marks (e.g. in Devanagari). Names can also contain any of the
+// common apostrophe variants ("O'Brien", "O’Brien"), and ideographic spaces.
+var name = trimmedTerminal(`^[\pL\pM\pN\.\-_ \x{3000}"'\x{2018}\x{2019}\x{02BC}]+`, "NAME")
+
+// Any single character that can't start a valid token.
+var unexpected = p.Token(`^[^}]`, "UNEXPECTED")
 
 func filter(s p.Scanner) (p.ParsecNode, p.Scanner) {
 	n, s2 := p.Token(`^[a-z]+`, "FILTER")(s)
@@ -30,8 +55,10 @@ func filter(s p.Scanner) (p.ParsecNode, p.Scanner) {
 	}
 }
 
+// Tags can contain the same letters, digits and apostrophes as names
+// ("O'Brien Family"), but not the other punctuation.
 func tag(s p.Scanner) (p.ParsecNode, p.Scanner) {
-	n, s2 := p.Token(`^[0-9a-zA-Z_ ]+`, "TAG")(s)
+	n, s2 := p.Token(`^[\pL\pM\pN_ '\x{2018}\x{2019}\x{02BC}]+`, "TAG")(s)
 	if tag, ok := n.(*p.Terminal); ok {
 		return Tag(strings.TrimSpace(tag.Value)), s2
 	} else {
@@ -39,6 +66,54 @@ func tag(s p.Scanner) (p.ParsecNode, p.Scanner) {
 	}
 }
 
+// The key of a key/value tag ("era" in "era=1950s"). Unlike tags, keys can't
+// contain spaces.
+var attributeKey = trimmedTerminal(`^[\pL\pM\pN_]+`, "ATTRIBUTE_KEY")
+
+// A (positive) weight for a name or block, like "*50" or "*0.5".
+func weight(s p.Scanner) (p.ParsecNode, p.Scanner) {
+	n, s2 := p.Token(`^\*\s*[0-9]*\.?[0-9]+`, "WEIGHT")(s)
+	if t, ok := n.(*p.Terminal); ok {
+		value := strings.TrimSpace(t.Value[1:])
+		if f, err := strconv.ParseFloat(value, 64); err == nil && f > 0 {
+			return f, s2
+		}
+	}
+	return nil, s
+}
+
+// A probability from 0 to 1 (e.g. "0.3", ".25" or "1"). Larger numbers
+// (like "1.5") don't match at all, rather than matching the "1".
+func probability(s p.Scanner) (p.ParsecNode, p.Scanner) {
+	n, s2 := p.Token(`^([0-9]+\.?[0-9]*|\.[0-9]+)`, "PROBABILITY")(s)
+	if t, ok := n.(*p.Terminal); ok {
+		if f, err := strconv.ParseFloat(t.Value, 64); err == nil && f <= 1 {
+			return f, s2
+		}
+	}
+	return nil, s
+}
+
+// A number to compare an attribute to, like "1950", "-3" or "0.5".
+func number(s p.Scanner) (p.ParsecNode, p.Scanner) {
+	n, s2 := p.Token(`^-?[0-9]*\.?[0-9]+`, "NUMBER")(s)
+	if t, ok := n.(*p.Terminal); ok {
+		if f, err := strconv.ParseFloat(t.Value, 64); err == nil {
+			return f, s2
+		}
+	}
+	return nil, s
+}
+
+// A numeric comparison operator.
+func comparison(s p.Scanner) (p.ParsecNode, p.Scanner) {
+	n, s2 := p.Token(`^(>=|<=|>|<)`, "COMPARISON")(s)
+	if t, ok := n.(*p.Terminal); ok {
+		return t.Value, s2
+	}
+	return nil, s
+}
+
 // Punctuation
 
 var lbrace = p.Token(`^{`, "LBRACE")
@@ -50,3 +125,11 @@ var comma = p.Token(`^,`, "COMMA")
 var minus = p.Token(`^\-`, "MINUS")
 var pipe = p.Token(`^\|`, "PIPE")
 var plus = p.Token(`^\+`, "PLUS")
+var question = p.Token(`^\?`, "QUESTION")
+var gt = p.Token(`^>`, "GT")
+var equals = p.Token(`^=`, "EQUALS")
+var notEquals = p.Token(`^!=`, "NOT_EQUALS")
+var lparen = p.Token(`^\(`, "LPAREN")
+var rparen = p.Token(`^\)`, "RPAREN")
+var inKeyword = p.Token(`^in\b`, "IN")
+var dotDot = p.Token(`^\.\.`, "DOTDOT")